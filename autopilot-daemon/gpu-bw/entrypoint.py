@@ -1,5 +1,9 @@
 import argparse
 import os
+import sys
+
+sys.path.append(os.path.join(os.path.dirname(os.path.abspath(__file__)), '..', 'utils'))
+import result_protocol as protocol
 
 
 def main():
@@ -12,29 +16,45 @@ def main():
     # print(result)
 
     if "ABORT" not in result:
-        print("[[ PCIEBW ]] Briefings completed. Continue with PCIe Bandwidth evaluation.")
+        protocol.say("[[ PCIEBW ]] Briefings completed. Continue with PCIe Bandwidth evaluation.")
         output = os.popen('./gpu-bw/gpuLocalBandwidthTest.sh -t ' + args.threshold)
         result = output.read()
 
         if "ABORT" in result or "SKIP" in result:
-            print("[[ PCIEBW ]] ABORT")
-            print(result)
+            protocol.say(result)
+            if protocol.enabled():
+                protocol.status("ABORT", "[[ PCIEBW ]] ABORT")
+            else:
+                print("[[ PCIEBW ]] ABORT")
+                print(result)
             exit()
 
-        print("SUCCESS")
-        print("Host ", os.getenv("NODE_NAME"))
         splitres = result.split("\n")
-        bws = ""
+        bws = []
         for line in splitres:
             if "Bandwidth =" in line:
                 x = line.split("= ", 2)
                 y = x[1].split(" GB/s")
-                bws += y[0] + " "
-        print(bws.strip())
+                bws.append(y[0])
+        if protocol.enabled():
+            protocol.say("Host ", os.getenv("NODE_NAME"))
+            fail = False
+            for gpuid, bw in enumerate(bws):
+                protocol.observation(gpuid, bw, unit="GB/s", threshold=args.threshold)
+                fail = fail or float(bw) < float(args.threshold)
+            protocol.status("FAIL" if fail else "PASS", "[[ PCIEBW ]] " + ("FAIL" if fail else "SUCCESS"))
+            return
+        print("SUCCESS")
+        print("Host ", os.getenv("NODE_NAME"))
+        print(" ".join(bws))
     else:
+        if protocol.enabled():
+            protocol.say(result)
+            protocol.status("ABORT", "[[ PCIEBW ]] ABORT")
+            return
         print("[[ PCIEBW ]] ABORT")
         print(result)
 
 
 if __name__ == '__main__':
-    main()
\ No newline at end of file
+    main()
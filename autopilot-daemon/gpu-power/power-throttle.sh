@@ -1,11 +1,23 @@
 #!/bin/bash
+source "$(dirname "$0")/../utils/result_protocol.sh"
+
+# Free text output, wrapped in log records when the result protocol is enabled
+say() {
+  if protocol_enabled; then
+    protocol_log "$*"
+  else
+    echo "$*"
+  fi
+}
+
 OUT="$(bash /home/autopilot/utils/briefings.sh | grep ABORT)"
-echo ${OUT}
+say ${OUT}
 if [[ ! -z $OUT ]]; then
-    echo "[[GPU POWER]] ABORT"
+    say "[[GPU POWER]] ABORT"
+    protocol_status ABORT "[[GPU POWER]] ABORT"
     exit 0
 fi
-echo "[[GPU POWER]] Briefings completed. Continue with power cap evaluation."
+say "[[GPU POWER]] Briefings completed. Continue with power cap evaluation."
 
 RES=$(ls -d /dev/nvidia* 2>1)
 numre='^[0-9]+$'
@@ -18,18 +30,19 @@ for d in $RES; do
   fi
 done
 if [[ $D -eq 0 ]]; then
-  echo -n "[GPU POWER] Detected NVIDIA GPU: "
+  DETECTED="[GPU POWER] Detected NVIDIA GPU: "
   for d in $RES; do
     d=${d#*"nvidia"*}
     if [[ "$d" =~ $numre ]]; then
-      echo -n "$d "
+      DETECTED+="$d "
       D=$((D+1))
     fi
   done
-  echo "Total: $D"
+  say "${DETECTED}Total: $D"
 else
-  echo "[GPU POWER] No NVIDIA GPU detected. Skipping the Power Throttle check."
-  echo "ABORT"
+  say "[GPU POWER] No NVIDIA GPU detected. Skipping the Power Throttle check."
+  say "ABORT"
+  protocol_status ABORT "[GPU POWER] ABORT"
   exit 0
 fi
 RESULT=""
@@ -39,14 +52,20 @@ for i in $(seq 0 1 $((D-1))) ; do
   NOTACTIVE=$(echo $OUT | grep "Not Active")
   if [[ ! -z "$NOTACTIVE" ]]; then
     RESULT+="0 "
+    protocol_observation $i 0
   else
     RESULT+="1 "
+    protocol_observation $i 1
     FAIL=1
   fi
 done
 if [[ $FAIL -ne 0 ]]; then
-  echo "[GPU POWER] FAIL"
+  say "[GPU POWER] FAIL"
+  protocol_status FAIL
 else
-  echo "[GPU POWER] SUCCESS"
+  say "[GPU POWER] SUCCESS"
+  protocol_status PASS
+fi
+if ! protocol_enabled; then
+  echo $RESULT
 fi
-echo $RESULT
\ No newline at end of file
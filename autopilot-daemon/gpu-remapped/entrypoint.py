@@ -1,15 +1,22 @@
 import os
+import sys
+
+sys.path.append(os.path.join(os.path.dirname(os.path.abspath(__file__)), '..', 'utils'))
+import result_protocol as protocol
 
 
 def main():
     output = os.popen('bash ./utils/briefings.sh')
     result = output.read()
-    print(result)
+    protocol.say(result)
 
     if "ABORT" not in result:
-        print("[[ REMAPPED ROWS ]] Briefings completed. Continue with remapped rows evaluation.")
+        protocol.say("[[ REMAPPED ROWS ]] Briefings completed. Continue with remapped rows evaluation.")
         output = os.popen('./gpu-remapped/remapped-rows.sh')
         result = output.read()
+        if protocol.enabled():
+            report(result)
+            return
         if "FAIL" not in result:
             print("[[ REMAPPED ROWS ]] SUCCESS")
         else:
@@ -20,8 +27,26 @@ def main():
         print("Host ", os.getenv("NODE_NAME"))
         print(result.strip())
     else:
+        if protocol.enabled():
+            protocol.status("ABORT", "[[ REMAPPED ROWS ]] ABORT")
+            return
         print("[[ REMAPPED ROWS ]] ABORT")
         print(result.strip())
 
+# The last line of remapped-rows.sh has one entry per GPU, 1 if the GPU has pending remapped rows
+def report(result):
+    lines = result.strip().split("\n")
+    protocol.say("\n".join(lines[:-1]))
+    protocol.say("Host ", os.getenv("NODE_NAME"))
+    if "SKIP" in result:
+        protocol.status("ABORT", "[[ REMAPPED ROWS ]] ABORT")
+        return
+    for gpuid, rm in enumerate(lines[-1].split()):
+        protocol.observation(gpuid, rm)
+    if "FAIL" in result:
+        protocol.status("FAIL", "[[ REMAPPED ROWS ]] FAIL")
+    else:
+        protocol.status("PASS", "[[ REMAPPED ROWS ]] SUCCESS")
+
 if __name__ == '__main__':
-    main()
\ No newline at end of file
+    main()
@@ -0,0 +1,34 @@
+#!/usr/bin/env bash
+
+# Regenerates the deepcopy functions of the API types in pkg/apis and the clientset in pkg/generated,
+# with the code generator matching the version of client-go.
+
+set -o errexit
+set -o nounset
+set -o pipefail
+
+SCRIPT_ROOT=$(cd "$(dirname "${BASH_SOURCE[0]}")/.." && pwd)
+CODEGEN_VERSION=$(cd "${SCRIPT_ROOT}" && go list -m -f '{{.Version}}' k8s.io/client-go)
+CODEGEN_PKG=${CODEGEN_PKG:-$(go env GOMODCACHE)/k8s.io/code-generator@${CODEGEN_VERSION}}
+if [ ! -d "${CODEGEN_PKG}" ]; then
+  go mod download "k8s.io/code-generator@${CODEGEN_VERSION}"
+fi
+
+source "${CODEGEN_PKG}/kube_codegen.sh"
+
+# The generators write to a GOPATH-like tree
+OUTPUT_BASE=$(mktemp -d)
+trap 'rm -rf "${OUTPUT_BASE}"' EXIT
+mkdir -p "${OUTPUT_BASE}/github.com/IBM"
+ln -s "${SCRIPT_ROOT}" "${OUTPUT_BASE}/github.com/IBM/autopilot"
+
+kube::codegen::gen_helpers \
+  --input-pkg-root github.com/IBM/autopilot/pkg/apis \
+  --output-base "${OUTPUT_BASE}" \
+  --boilerplate "${SCRIPT_ROOT}/hack/boilerplate.go.txt"
+
+kube::codegen::gen_client \
+  --input-pkg-root github.com/IBM/autopilot/pkg/apis \
+  --output-pkg-root github.com/IBM/autopilot/pkg/generated \
+  --output-base "${OUTPUT_BASE}" \
+  --boilerplate "${SCRIPT_ROOT}/hack/boilerplate.go.txt"
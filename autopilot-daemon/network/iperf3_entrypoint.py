@@ -54,10 +54,10 @@ async def make_server_connection(event, address, handle):
     try:
         if event != None:
             await event.wait()
-        url = f"http://{address}:{AUTOPILOT_PORT}{handle}"
+        url = f"{AUTOPILOT_SCHEME}://{address}:{AUTOPILOT_PORT}{handle}"
         total_timeout = aiohttp.ClientTimeout(total=60 * 10)
         async with aiohttp.ClientSession(timeout=total_timeout) as session:
-            async with session.get(url) as resp:
+            async with session.get(url, headers=AUTH_HEADERS, **TLS_ARGS) as resp:
                 reply = await resp.text()
     except Exception as e:
         # If we can't create servers we'll need to exit...something has gone wrong
@@ -71,10 +71,10 @@ async def make_client_connection(event, iface, src, dst, address, handle):
     try:
         if event != None:
             await event.wait()
-        url = f"http://{address}:{AUTOPILOT_PORT}{handle}"
+        url = f"{AUTOPILOT_SCHEME}://{address}:{AUTOPILOT_PORT}{handle}"
         total_timeout = aiohttp.ClientTimeout(total=60 * 10)
         async with aiohttp.ClientSession(timeout=total_timeout) as session:
-            async with session.get(url) as resp:
+            async with session.get(url, headers=AUTH_HEADERS, **TLS_ARGS) as resp:
                 reply = await resp.text()
                 reply = "".join(reply.split())
                 try:
@@ -5,6 +5,7 @@ import asyncio
 import logging
 import aiohttp
 import os
+import ssl
 import json
 import requests
 import netifaces
@@ -33,3 +34,20 @@ CURR_POD_NAME = os.getenv("POD_NAME")
 CURR_WORKER_NODE_NAME = os.getenv("NODE_NAME")
 AUTOPILOT_NAMESPACE = os.getenv("NAMESPACE")
 AUTOPILOT_PORT = os.getenv("AUTOPILOT_HEALTHCHECKS_SERVICE_PORT")
+
+# When the autopilot pods serve TLS, verify them and present them the certificate of the daemon, with the files it uses
+AUTOPILOT_SCHEME = "http"
+TLS_ARGS = {}
+if os.getenv("AUTOPILOT_TLS_CERT_FILE"):
+    AUTOPILOT_SCHEME = "https"
+    _ssl_context = ssl.create_default_context(cafile=os.getenv("AUTOPILOT_TLS_CA_FILE") or None)
+    _ssl_context.load_cert_chain(os.getenv("AUTOPILOT_TLS_CERT_FILE"), os.getenv("AUTOPILOT_TLS_KEY_FILE"))
+    # Pods are called by IP, their certificate is valid for the service name
+    TLS_ARGS = {"ssl": _ssl_context, "server_hostname": os.getenv("AUTOPILOT_TLS_SERVER_NAME")}
+
+# Authenticate to the autopilot pods with the service account token, in case they require it
+AUTH_HEADERS = {}
+TOKEN_FILE = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+if os.path.exists(TOKEN_FILE):
+    with open(TOKEN_FILE) as f:
+        AUTH_HEADERS["Authorization"] = "Bearer " + f.read().strip()
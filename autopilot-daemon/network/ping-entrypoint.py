@@ -7,6 +7,10 @@ import asyncio
 import subprocess
 import time
 import netifaces
+import sys
+
+sys.path.append(os.path.join(os.path.dirname(os.path.abspath(__file__)), '..', 'utils'))
+import result_protocol as protocol
 
 parser = argparse.ArgumentParser()
 parser.add_argument('--job', type=str, default='None', help='Workload node discovery w/ given namespace and label. Ex: \"--job=namespace:label-key=label-value\". Default is set to None.')
@@ -35,34 +39,32 @@ async def main():
 
     nodes={}
     ifaces=set()
-    print("[PING] Pod running ping: ", os.getenv("POD_NAME"))
-    print("[PING] Starting: collecting node list")
+    protocol.say("[PING] Pod running ping: ", os.getenv("POD_NAME"))
+    protocol.say("[PING] Starting: collecting node list")
     try:
         retries = 0
         daemonset_size = expectedPods()
         autopilot_pods = kubeapi.list_namespaced_pod(namespace=namespace_self, label_selector="app=autopilot")
         while len(autopilot_pods.items) < daemonset_size or retries > 100:
-            print("[PING] Waiting for all Autopilot pods to run")
+            protocol.say("[PING] Waiting for all Autopilot pods to run")
             time.sleep(5)
             autopilot_pods = kubeapi.list_namespaced_pod(namespace=namespace_self, label_selector="app=autopilot")
             retries +=1
         if retries > 100 and len(autopilot_pods.items) < daemonset_size:
-            print("[PING] Reached max retries of 100. ABORT")
-            exit()
+            abort("[PING] Reached max retries of 100. ABORT")
 
     except ApiException as e:
-        print("Exception when calling CoreV1Api->list_namespaced_pod: %s\n" % e)
-        exit()
+        abort("Exception when calling CoreV1Api->list_namespaced_pod: %s\n" % e)
 
     # run through all pods and create a map of all interfaces
-    print("Creating a list of interfaces and IPs")
+    protocol.say("Creating a list of interfaces and IPs")
     entrylist = json.loads('{}')
     for pod in autopilot_pods.items:
         if pod.spec.node_name != nodename_self and (allnodes or (pod.spec.node_name in nodemap.keys())):
             try:
                 entrylist = json.loads(pod.metadata.annotations['k8s.v1.cni.cncf.io/network-status'])
             except KeyError:
-                print("Key k8s.v1.cni.cncf.io/network-status not found on pod", pod.metadata.name, "- node", pod.spec.node_name)
+                protocol.say("Key k8s.v1.cni.cncf.io/network-status not found on pod", pod.metadata.name, "- node", pod.spec.node_name)
             if len(entrylist) > 0 :
                 node={}
                 nodes[pod.spec.node_name] = node
@@ -70,7 +72,7 @@ async def main():
                     try:
                         iface=entry['interface']
                     except KeyError:
-                        print("Interface key name not found, assigning 'k8s-pod-network'.")
+                        protocol.say("Interface key name not found, assigning 'k8s-pod-network'.")
                         iface = "k8s-pod-network"
                     ifaces = ifaces | {iface}
                     node[iface] = {
@@ -95,10 +97,9 @@ async def main():
 
 
     if len(nodes.keys()) == 0:
-        print("[PING] No nodes found. ABORT")
-        exit(0)
+        abort("[PING] No nodes found. ABORT")
     # run ping tests to each pod on each interface
-    print("[PING] Running ping tests for every interface")
+    protocol.say("[PING] Running ping tests for every interface")
     conn_dict = dict()
     clients = []
     for nodename in nodes.keys():
@@ -107,7 +108,7 @@ async def main():
             try:
                 ips = nodes[nodename][iface]['ips']
             except KeyError:
-                print("Interface", iface, "not found, skipping.")
+                protocol.say("Interface", iface, "not found, skipping.")
                 continue
             for index, ip in enumerate(ips):
                 command = ['ping',ip,'-t','45','-c','10']
@@ -117,25 +118,43 @@ async def main():
         try:
             c[0].wait(50)
         except:
-            print("Timeout while waiting for", c[2], "on node", c[1])
+            protocol.say("Timeout while waiting for", c[2], "on node", c[1])
             continue
     fail = False
+    # a node is unreachable if any of its interfaces is
+    unreachable = {}
     for c in clients:
         stdout, stderr = c[0].communicate()
+        unreachable.setdefault(c[1], 0)
         if stderr:
-            print("[PING] output parse exited with error: " + stderr)
+            protocol.say("[PING] output parse exited with error: " + stderr)
             fail = True
         else:
             if "Unreachable" in stdout or "100% packet loss" in stdout:
-                print("Node", c[1], c[2], c[3], "1")
+                protocol.say("Node", c[1], c[2], c[3], "1")
+                unreachable[c[1]] = 1
                 fail = True
             else:
-                print("Node", c[1], c[2], c[3], "0")
+                protocol.say("Node", c[1], c[2], c[3], "0")
+    if protocol.enabled():
+        for nodename, value in unreachable.items():
+            protocol.observation(nodename, value)
+        if fail:
+            protocol.status("FAIL", "[PING] At least one node unreachable. FAIL")
+        else:
+            protocol.status("PASS", "[PING] all nodes reachable. success")
+        return
     if fail:
-        print("[PING] At least one node unreachable. FAIL")
+        protocol.say("[PING] At least one node unreachable. FAIL")
     else:
-        print("[PING] all nodes reachable. success")
+        protocol.say("[PING] all nodes reachable. success")
             
+def abort(*message):
+    protocol.say(*message)
+    if protocol.enabled():
+        protocol.status("ABORT", "[PING] ABORT")
+    exit()
+
 def check_local_ifaces():
     podname = os.getenv("POD_NAME")
     pod_list = kubeapi.list_namespaced_pod(namespace=namespace_self, field_selector="metadata.name="+podname)
@@ -147,7 +166,7 @@ def check_local_ifaces():
     try:
         entrylist = json.loads(pod_self.metadata.annotations['k8s.v1.cni.cncf.io/network-status'])
     except KeyError:
-        print("Key k8s.v1.cni.cncf.io/network-status not found on pod", pod_self.metadata.name, "-  node", pod_self.spec.node_name)
+        protocol.say("Key k8s.v1.cni.cncf.io/network-status not found on pod", pod_self.metadata.name, "-  node", pod_self.spec.node_name)
     if len(entrylist) > 0:
         for entry in entrylist:
             try:
@@ -156,8 +175,7 @@ def check_local_ifaces():
                 continue
             for ip in entry['ips']:
                 if ip not in ip_addresses:
-                    print("[PING] IFACES count inconsistent. Pod annotation reports", entry['ips'], ", not found in the pod among", ip_addresses, "ABORT")
-                    exit()
+                    abort("[PING] IFACES count inconsistent. Pod annotation reports", entry['ips'], ", not found in the pod among", ip_addresses, "ABORT")
             ips.append(entry['ips'])
             iface_count += len(entry['ips'])
     else:
@@ -165,8 +183,7 @@ def check_local_ifaces():
         if pod_ips != None:
             for pod_ip in pod_ips:
                 if pod_ip.ip not in ip_addresses:
-                    print("[PING] IFACES count inconsistent. Pod annotation reports", pod_ip.ip, ", not found in the pod among", ip_addresses, "ABORT")
-                    exit()
+                    abort("[PING] IFACES count inconsistent. Pod annotation reports", pod_ip.ip, ", not found in the pod among", ip_addresses, "ABORT")
                 ips.append(pod_ip.ip)
         iface_count += len(pod_ips)
 
@@ -185,9 +202,9 @@ def get_job_nodes(nodelist):
         try:
             job_pods = v1.list_namespaced_pod(namespace=job_ns, label_selector=job_label)
         except ApiException as e:
-            print("[PING] Exception when calling CoreV1Api->list_namespaced_pod: %s\n" % e)
+            protocol.say("[PING] Exception when calling CoreV1Api->list_namespaced_pod: %s\n" % e)
 
-        print('[PING] Workload:', ': '.join(job))
+        protocol.say('[PING] Workload:', ': '.join(job))
         for pod in job_pods.items:
             if pod.spec.node_name != node_name_self:
                 nodemap[pod.spec.node_name] = True
@@ -197,11 +214,9 @@ def get_job_nodes(nodelist):
         try:
             labeled_nodes = v1.list_node(label_selector=nodelabel)
         except ApiException as e:
-            print("Exception when calling CoreV1Api->list_node: %s\n" % e)
-            exit()
+            abort("Exception when calling CoreV1Api->list_node: %s\n" % e)
         if len(labeled_nodes.items) == 0:
-            print ("No node is labeled with", nodelabel, " - ABORT.")
-            exit()
+            abort("No node is labeled with", nodelabel, " - ABORT.")
         for labeled_node in labeled_nodes.items:
             if labeled_node.metadata.name != node_name_self:
                 nodemap[labeled_node.metadata.name] = True
@@ -218,7 +233,7 @@ def expectedPods():
     try:
         autopilot = v1.list_namespaced_daemon_set(namespace=namespace_self, label_selector="app=autopilot")
     except ApiException as e:
-        print("[PING] Exception when calling fetching Autopilot by corev1api->list_namespaced_daemon_set", e)
+        protocol.say("[PING] Exception when calling fetching Autopilot by corev1api->list_namespaced_daemon_set", e)
         return 0
     return autopilot.items[0].status.desired_number_scheduled
 
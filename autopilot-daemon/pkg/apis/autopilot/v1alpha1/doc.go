@@ -0,0 +1,5 @@
+// Package v1alpha1 is the v1alpha1 version of the autopilot.ibm.com API group, holding the NodeHealth resource.
+//
+// +k8s:deepcopy-gen=package
+// +groupName=autopilot.ibm.com
+package v1alpha1
@@ -0,0 +1,78 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// NodeHealth is the health of a node, as found by the health checks of the Autopilot pod running on it.
+// It has the name of the node, and is owned by it. The status is only written by the Autopilot pod of the node.
+type NodeHealth struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Status NodeHealthStatus `json:"status,omitempty"`
+}
+
+// NodeHealthStatus is the state of the health checks of a node
+type NodeHealthStatus struct {
+	// PASS, or WARN if any check counts against the node health, as the autopilot.ibm.com/gpuhealth label
+	Health string `json:"health,omitempty"`
+	// Comma separated checks counting against the node health
+	FailedChecks string `json:"failedChecks,omitempty"`
+	GPUModel     string `json:"gpuModel,omitempty"`
+	CPUModel     string `json:"cpuModel,omitempty"`
+	// Threshold profile matching the node, if any
+	Profile string `json:"profile,omitempty"`
+	// Last run of any check
+	LastRun *metav1.Time `json:"lastRun,omitempty"`
+	// Last update of the status
+	LastUpdate metav1.Time `json:"lastUpdate,omitempty"`
+	// State of each check run on the node, sorted by name
+	Checks []CheckStatus `json:"checks,omitempty"`
+}
+
+// CheckStatus is the state of a health check on a node, from its past runs
+type CheckStatus struct {
+	Name string `json:"name"`
+	// Status of the last run: PASS, WARN, FAIL, ABORT, ERROR or TIMEOUT
+	Status string `json:"status,omitempty"`
+	// Whether the check counts against the node health, once the fail-after and recover-after thresholds are applied
+	Failed bool `json:"failed"`
+	// Consecutive failed and successful runs
+	Failures    int32        `json:"failures,omitempty"`
+	Successes   int32        `json:"successes,omitempty"`
+	LastRun     *metav1.Time `json:"lastRun,omitempty"`
+	LastSuccess *metav1.Time `json:"lastSuccess,omitempty"`
+	// Error of the last run that did not complete, and when it happened
+	LastError     string       `json:"lastError,omitempty"`
+	LastErrorTime *metav1.Time `json:"lastErrorTime,omitempty"`
+	// Observations of the last run that agrees with the state of the check
+	Observations []Observation `json:"observations,omitempty"`
+}
+
+// Observation is a single measurement of a health check, usually one per GPU.
+// Values are decimal numbers, kept as strings as floats are not portable across API clients.
+type Observation struct {
+	// GPU id, remote node name for ping, empty for node-wide checks (e.g., dcgm, pvc)
+	DeviceID string `json:"deviceID,omitempty"`
+	Value    string `json:"value"`
+	Unit     string `json:"unit,omitempty"`
+	// Lowest acceptable value, if the check compares the value against a threshold
+	Threshold string `json:"threshold,omitempty"`
+	// Highest acceptable value, if the check compares the value against a maximum
+	MaxThreshold string `json:"maxThreshold,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// NodeHealthList is a list of NodeHealth
+type NodeHealthList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []NodeHealth `json:"items"`
+}
@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/IBM/autopilot/pkg/handler"
@@ -23,6 +29,21 @@ func main() {
 	v := flag.String("loglevel", "2", "Log level")
 	repeat := flag.String("w", "24h", "Run all tests periodically on each node. Time set in interval format. Defaults to 24h")
 	invasive := flag.String("invasive-check-timer", "4h", "Run invasive checks (e.g., dcgmi level 3) on each node when GPUs are free. Time set in interval format. Defaults to 4h. Set to 0 to avoid invasive checks")
+	startupDelay := flag.String("startup-delay", "0", "Delay before the first periodic checks after startup, in interval format. Defaults to 0")
+	splay := flag.String("splay", "0", "Maximum delay added to the periodic and invasive check timers of each node, in interval format. The delay is derived from the node name. Defaults to 0")
+	stateFile := flag.String("state-file", "", "File where the state of the health checks is saved, and restored from at startup. Usually on a hostPath volume. Not saved if empty")
+	thresholdProfiles := flag.String("threshold-profiles", "/etc/autopilot/threshold-profiles/profiles.yaml", "YAML file of the threshold profiles, usually mounted from a ConfigMap")
+	checkSpecsDir := flag.String("check-specs-dir", "/etc/autopilot/custom-checks", "Directory of the declarative custom health checks, one YAML spec per file run with the command and rules it declares, usually mounted from the customChecks ConfigMap")
+	auth := flag.Bool("auth", false, "Require a bearer token on the health checks port, authenticated through the TokenReview API and authorized per endpoint through the SubjectAccessReview API")
+	authCacheTTL := flag.String("auth-cache-ttl", "1m", "How long token and access reviews are cached, in interval format. Defaults to 1m")
+	tlsCertFile := flag.String("tls-cert-file", "", "Certificate served on the health checks, metrics and readiness ports, usually mounted from a secret. Reloaded when it changes. Plain HTTP if empty")
+	tlsKeyFile := flag.String("tls-key-file", "", "Key of the TLS certificate")
+	tlsCAFile := flag.String("tls-ca-file", "", "CA bundle verifying the certificates of the other Autopilot pods, for mutual TLS between them. Client certificates are not verified if empty")
+	tlsRequireClientCert := flag.Bool("tls-require-client-cert", false, "Require a client certificate signed by the CA bundle on the health checks port")
+	tlsServerName := flag.String("tls-server-name", "", "Name the certificates of the other Autopilot pods must be valid for. Defaults to autopilot-healthchecks.<namespace>.svc")
+	scriptChecksDir := flag.String("script-checks-dir", "./checks.d", "Directory of custom health check executables speaking the result protocol, usually mounted from a volume. Each file is registered as a health check named after it")
+	nodeHealth := flag.Bool("nodehealth", false, "Report the state of the health checks in the status of the NodeHealth resource named after the node. Requires the NodeHealth CRD")
+	shutdownTimeout := flag.String("shutdown-timeout", "20s", "How long to wait for the running health checks to stop on SIGTERM before cleaning up and exiting, in interval format. Should be lower than the termination grace period of the pod. Defaults to 20s")
 
 	flag.Parse()
 
@@ -41,22 +62,96 @@ func main() {
 		BWThreshold: *bwThreshold,
 	}
 
+	shutdownDuration, err := utils.ParseInterval(*shutdownTimeout)
+	if err != nil {
+		klog.Error("Error parsing shutdown timeout: ", err)
+		os.Exit(1)
+	}
+	// Cancelled on SIGTERM, stopping the periodic checks and the requests in flight
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
 	reg := prometheus.NewRegistry()
 	utils.InitMetrics(reg)
 
 	utils.InitHardwareMetrics()
 
+	// Register the custom health checks before anything reads the list of checks
+	healthcheck.LoadScriptChecks(*scriptChecksDir)
+	if err := healthcheck.LoadCustomChecks(*checkSpecsDir); err != nil {
+		klog.Error("Error loading the custom health checks: ", err)
+		os.Exit(1)
+	}
+
+	if err := healthcheck.InitSettings(); err != nil {
+		klog.Error("Error reading the settings: ", err)
+		os.Exit(1)
+	}
+	if err := healthcheck.InitCheckTimeouts(); err != nil {
+		klog.Error("Error parsing CHECK_TIMEOUTS: ", err)
+		os.Exit(1)
+	}
+	if err := healthcheck.InitCheckHysteresis(); err != nil {
+		klog.Error(err)
+		os.Exit(1)
+	}
+
+	err = healthcheck.LoadThresholdProfiles(*thresholdProfiles, func() (map[string]string, error) {
+		node, err := utils.GetNode(utils.NodeName)
+		if err != nil {
+			return nil, err
+		}
+		return node.Labels, nil
+	})
+	if err != nil {
+		klog.Error("Error loading threshold profiles: ", err)
+		os.Exit(1)
+	}
+
 	// Init the node status map
 	healthcheck.InitNodeStatusMap()
+	// Continue from the state saved before a restart
+	if err := healthcheck.InitStateFile(*stateFile); err != nil {
+		klog.Error("Error restoring the state, starting from scratch: ", err)
+	}
+
+	var tlsFiles *utils.TLSFiles
+	hcClientAuth := tls.NoClientCert
+	if *tlsCertFile != "" {
+		tlsFiles, err = utils.NewTLSFiles(*tlsCertFile, *tlsKeyFile, *tlsCAFile)
+		if err != nil {
+			klog.Error("Error loading the TLS certificate: ", err)
+			os.Exit(1)
+		}
+		if *tlsCAFile != "" {
+			hcClientAuth = tls.VerifyClientCertIfGiven
+			if *tlsRequireClientCert {
+				hcClientAuth = tls.RequireAndVerifyClientCert
+			}
+		}
+		if *tlsServerName == "" {
+			*tlsServerName = "autopilot-healthchecks." + utils.Namespace + ".svc"
+		}
+		// The scripts calling the other Autopilot pods, like the iperf workload, use the same files
+		os.Setenv("AUTOPILOT_TLS_CERT_FILE", *tlsCertFile)
+		os.Setenv("AUTOPILOT_TLS_KEY_FILE", *tlsKeyFile)
+		os.Setenv("AUTOPILOT_TLS_CA_FILE", *tlsCAFile)
+		os.Setenv("AUTOPILOT_TLS_SERVER_NAME", *tlsServerName)
+		healthcheck.InitRemoteClient(tlsFiles, *tlsServerName)
+	} else if *tlsRequireClientCert {
+		klog.Error("Client certificates require TLS, set --tls-cert-file")
+		os.Exit(1)
+	}
 
 	pMux := http.NewServeMux()
 	promHandler := promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
 	pMux.Handle("/metrics", promHandler)
+	metricsServer := &http.Server{Addr: ":8081", Handler: pMux}
 
 	go func() {
 		klog.Info("Serving metrics on :8081")
-		err := http.ListenAndServe(":8081", pMux)
-		if err != nil {
+		err := serve(metricsServer, tlsFiles, tls.NoClientCert)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			klog.Error(err.Error())
 			os.Exit(1)
 		}
@@ -64,11 +159,12 @@ func main() {
 
 	readinessMux := http.NewServeMux()
 	readinessMux.Handle("/readinessprobe", handler.ReadinessProbeHandler())
+	readinessServer := &http.Server{Addr: ":8080", Handler: readinessMux}
 
 	go func() {
 		klog.Info("Serving Readiness Probe on :8080")
-		err := http.ListenAndServe(":8080", readinessMux)
-		if err != nil {
+		err := serve(readinessServer, tlsFiles, tls.NoClientCert)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			klog.Error(err.Error())
 			os.Exit(1)
 		}
@@ -76,33 +172,48 @@ func main() {
 
 	hcMux := http.NewServeMux()
 
-	hcMux.Handle("/dcgm", handler.DCGMHandler())
-	hcMux.Handle("/gpumem", handler.GpuMemHandler())
-	hcMux.Handle("/gpupower", handler.GpuPowerHandler())
+	// Every registered health check is served on its own endpoint, e.g., /pciebw
+	for _, c := range healthcheck.RegisteredChecks() {
+		hcMux.Handle("/"+string(c.Name()), handler.CheckHandler(c))
+	}
 	hcMux.Handle("/iperf", handler.IperfHandler())
 	hcMux.Handle("/iperfservers", handler.StartIperfServersHandler())
 	hcMux.Handle("/iperfstopservers", handler.StopAllIperfServersHandler())
 	hcMux.Handle("/iperfclients", handler.StartIperfClientsHandler())
 	hcMux.Handle("/invasive", handler.InvasiveCheckHandler())
-	hcMux.Handle("/pciebw", handler.PCIeBWHandler())
-	hcMux.Handle("/ping", handler.PingHandler())
-	hcMux.Handle("/pvc", handler.PVCHandler())
-	hcMux.Handle("/remapped", handler.RemappedRowsHandler())
 	hcMux.Handle("/status", handler.SystemStatusHandler())
+	hcMux.Handle("/report", handler.ReportHandler())
+	hcMux.Handle("/state", handler.StateHandler())
+	hcMux.Handle("/history", handler.HistoryHandler())
+	hcMux.Handle(handler.APIPrefix, handler.APIHandler())
+
+	var hcHandler http.Handler = hcMux
+	if *auth {
+		ttl, err := utils.ParseInterval(*authCacheTTL)
+		if err != nil {
+			klog.Error("Error parsing auth cache TTL: ", err)
+			os.Exit(1)
+		}
+		klog.Info("Authentication and authorization enabled on port :", *port)
+		hcHandler = handler.NewAuthorizer(utils.GetClientsetInstance().Cset, ttl).Handler(hcMux)
+	}
 
 	s := &http.Server{
 		Addr:         ":" + *port,
-		Handler:      hcMux,
+		Handler:      hcHandler,
 		ReadTimeout:  30 * time.Minute,
 		WriteTimeout: 30 * time.Minute,
 		IdleTimeout:  30 * time.Minute,
+		// Requests are cancelled on SIGTERM, so that their checks stop
+		BaseContext: func(net.Listener) context.Context { return ctx },
 	}
 
 	go func() {
 		klog.Info("Serving Health Checks on port :", *port)
-		err := s.ListenAndServe()
+		err := serve(s, tlsFiles, hcClientAuth)
 		if errors.Is(err, http.ErrServerClosed) {
 			klog.Info("Server Closed")
+			return
 		} else if errors.Is(err, http.ErrAbortHandler) {
 			klog.Info("Server Aborted")
 		} else if errors.Is(err, http.ErrContentLength) {
@@ -122,8 +233,13 @@ func main() {
 	// Create a Watcher over nodes. Needed to export metrics from data created by external jobs (i.e., dcgm Jobs)
 	go utils.WatchNode()
 
-	// Run the health checks at startup, then start the timer
-	healthcheck.PeriodicCheck()
+	if *nodeHealth {
+		if err := healthcheck.InitNodeHealth(); err != nil {
+			klog.Error("Error creating the NodeHealth client: ", err)
+			os.Exit(1)
+		}
+		go healthcheck.RunNodeHealthUpdater(ctx)
+	}
 
 	// Parse the repeat and invasive intervals to durations
 	repeatDuration, err := utils.ParseInterval(*repeat)
@@ -137,29 +253,61 @@ func main() {
 		os.Exit(1)
 	}
 
-	periodicChecksTicker := time.NewTicker(repeatDuration)
-	defer periodicChecksTicker.Stop()
-	invasiveChecksTicker := time.NewTicker(invasiveDuration)
-	defer invasiveChecksTicker.Stop()
-	for {
-		select {
-		case <-periodicChecksTicker.C:
-			healthcheck.PeriodicCheck()
-		case <-invasiveChecksTicker.C:
-			if invasiveDuration > 0 {
-				healthcheck.InvasiveCheck()
-			}
-		}
+	startupDelayDuration, err := utils.ParseInterval(*startupDelay)
+	if err != nil {
+		klog.Error("Error parsing startup delay: ", err)
+		os.Exit(1)
+	}
+	splayDuration, err := utils.ParseInterval(*splay)
+	if err != nil {
+		klog.Error("Error parsing splay: ", err)
+		os.Exit(1)
+	}
+
+	// Run the health checks at startup, then each set of checks on its own schedule
+	start := time.Now().Add(startupDelayDuration)
+	jobs, err := healthcheck.GetScheduledJobs(repeatDuration, start, splayDuration)
+	if err != nil {
+		klog.Error("Error parsing CHECK_SCHEDULES: ", err)
+		os.Exit(1)
 	}
+	// Invasive checks first run one interval after startup
+	if invasiveDuration > 0 {
+		jobs = append(jobs, healthcheck.ScheduledJob{
+			Checks:   "invasive",
+			Schedule: healthcheck.WithSplay(healthcheck.NewIntervalSchedule(start, invasiveDuration, invasiveDuration), "invasive", splayDuration),
+			Run: func(ctx context.Context) {
+				healthcheck.InvasiveCheck(ctx)
+			},
+		})
+	}
+	healthcheck.RunScheduler(ctx, jobs)
 
-	// cert := "/etc/admission-webhook/tls/tls.crt"
-	// key := "/etc/admission-webhook/tls/tls.key"
+	klog.Info("Received termination signal, shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownDuration)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, server := range []*http.Server{s, metricsServer, readinessServer} {
+		wg.Add(1)
+		go func(server *http.Server) {
+			defer wg.Done()
+			if err := server.Shutdown(shutdownCtx); err != nil {
+				klog.Info("Server on ", server.Addr, " not shut down gracefully: ", err.Error())
+				server.Close()
+			}
+		}(server)
+	}
+	healthcheck.Shutdown(shutdownCtx)
+	wg.Wait()
+	klog.Info("Shutdown complete")
+	klog.Flush()
+}
 
-	// err := http.ListenAndServeTLS(":"+*port, cert, key, mux)
-	// if errors.Is(err, http.ErrServerClosed) {
-	// 	klog.Error("Server closed")
-	// } else if err != nil {
-	// 	klog.Error("error starting server: %s\n", err)
-	// 	os.Exit(1)
-	// }
+// serve serves s over TLS if tlsFiles is set, over plain HTTP otherwise
+func serve(s *http.Server, tlsFiles *utils.TLSFiles, clientAuth tls.ClientAuthType) error {
+	if tlsFiles == nil {
+		return s.ListenAndServe()
+	}
+	s.TLSConfig = tlsFiles.ServerConfig(clientAuth)
+	return s.ListenAndServeTLS("", "")
 }
@@ -0,0 +1,375 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/IBM/autopilot/pkg/healthcheck"
+	"github.com/IBM/autopilot/pkg/utils"
+	"k8s.io/klog/v2"
+)
+
+// Versioned JSON API, served next to the plain text endpoints. Errors are returned as {"error": "..."} with
+// 400 for invalid parameters, 404 for unknown resources, 405 for unsupported methods,
+// 409 when another health check is running and 500 when a check could not be executed.
+// Runs stream the output of the checks instead of returning JSON if the client asks for it, see newStreamWriter.
+const APIPrefix = "/api/v1/"
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// checkInfo describes a registered health check
+type checkInfo struct {
+	Name          healthcheck.HealthCheck `json:"name"`
+	Description   string                  `json:"description"`
+	Periodic      bool                    `json:"periodic"`
+	Concurrent    bool                    `json:"concurrent"`
+	Informational bool                    `json:"informational"`
+	MetricName    string                  `json:"metricName,omitempty"`
+	// Timeout of a run, in nanoseconds. Zero means no timeout
+	Timeout time.Duration `json:"timeout"`
+}
+
+// checkResponse is the result of a check run, with the error that prevented its execution, if any
+type checkResponse struct {
+	*healthcheck.CheckResult
+	Error string `json:"error,omitempty"`
+}
+
+// statusResponse is the outcome of a /status run
+type statusResponse struct {
+	Node string `json:"node"`
+	// Whether any check counts against the node health, for local runs
+	Failed  bool                       `json:"failed"`
+	Results []*healthcheck.CheckResult `json:"results,omitempty"`
+	// Outcome of the checks run on remote nodes, by node
+	Nodes map[string]*healthcheck.NodeResult `json:"nodes,omitempty"`
+	Error string                             `json:"error,omitempty"`
+}
+
+// APIHandler serves the /api/v1 endpoints:
+//
+//	GET  /api/v1/checks             registered checks
+//	GET  /api/v1/checks/<name>      a registered check
+//	POST /api/v1/checks/<name>/run  run a check on the local node
+//	POST /api/v1/status             same parameters as /status
+//	POST /api/v1/report             aggregated report of a run on the nodes of the cluster, same parameters as /status
+//	POST /api/v1/invasive           launch the invasive checks on the local node
+//	GET  /api/v1/runs               background runs
+//	POST /api/v1/runs               start a background run, same parameters as /status
+//	GET  /api/v1/runs/<id>          progress and results of a run
+//	DELETE /api/v1/runs/<id>        cancel a running run, or delete a finished one
+//	GET  /api/v1/state              same as /state
+//	GET  /api/v1/history            same as /history
+func APIHandler() http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		path := strings.Trim(strings.TrimPrefix(r.URL.Path, APIPrefix), "/")
+		parts := strings.Split(path, "/")
+		switch {
+		case path == "checks":
+			if allowMethods(w, r, http.MethodGet) {
+				listChecks(w)
+			}
+		case parts[0] == "checks" && (len(parts) == 2 || (len(parts) == 3 && parts[2] == "run")):
+			c, found := healthcheck.GetChecker(healthcheck.HealthCheck(parts[1]))
+			if !found {
+				writeError(w, http.StatusNotFound, "health check not found: "+parts[1])
+				return
+			}
+			if len(parts) == 2 {
+				if allowMethods(w, r, http.MethodGet) {
+					writeJSON(w, http.StatusOK, newCheckInfo(c))
+				}
+				return
+			}
+			if allowMethods(w, r, http.MethodPost) {
+				runCheckJSON(w, r, c)
+			}
+		case path == "status":
+			if allowMethods(w, r, http.MethodPost) {
+				runStatusJSON(w, r)
+			}
+		case path == "report":
+			if allowMethods(w, r, http.MethodPost) {
+				writeReport(w, r, "json")
+			}
+		case path == "invasive":
+			if allowMethods(w, r, http.MethodPost) {
+				runInvasiveJSON(w, r)
+			}
+		case path == "runs":
+			if !allowMethods(w, r, http.MethodGet, http.MethodPost) {
+				return
+			}
+			if r.Method == http.MethodPost {
+				startRun(w, r)
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]interface{}{"runs": healthcheck.Runs.List()})
+		case parts[0] == "runs" && len(parts) == 2:
+			if !allowMethods(w, r, http.MethodGet, http.MethodDelete) {
+				return
+			}
+			if r.Method == http.MethodDelete {
+				cancelRun(w, parts[1])
+				return
+			}
+			getRun(w, parts[1])
+		case path == "state":
+			if allowMethods(w, r, http.MethodGet) {
+				writeState(w, r)
+			}
+		case path == "history":
+			if allowMethods(w, r, http.MethodGet) {
+				writeHistory(w, r)
+			}
+		default:
+			writeError(w, http.StatusNotFound, "not found: "+r.URL.Path)
+		}
+	}
+	return http.HandlerFunc(fn)
+}
+
+func newCheckInfo(c healthcheck.Checker) checkInfo {
+	m := c.Metadata()
+	return checkInfo{
+		Name:          c.Name(),
+		Description:   m.Description,
+		Periodic:      m.Periodic,
+		Concurrent:    m.Concurrent,
+		Informational: m.Informational,
+		MetricName:    m.MetricName,
+		Timeout:       healthcheck.GetCheckTimeout(c),
+	}
+}
+
+func listChecks(w http.ResponseWriter) {
+	checks := []checkInfo{}
+	for _, c := range healthcheck.RegisteredChecks() {
+		checks = append(checks, newCheckInfo(c))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"checks": checks})
+}
+
+// runCheckJSON runs a single check on the local node, unless another check is running, see acquireLock
+func runCheckJSON(w http.ResponseWriter, r *http.Request, c healthcheck.Checker) {
+	if err := validateCheckParams(r.URL.Query()); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s := newStreamWriter(w, r)
+	if !acquireLock(w, r, string(c.Name()), s.progress()) {
+		return
+	}
+	defer utils.HealthcheckLock.Unlock()
+	if s != nil {
+		streamCheck(s, r, c)
+		return
+	}
+	result, err := healthcheck.RunCheck(r.Context(), c, checkParams(r))
+	if err != nil {
+		klog.Error(err.Error())
+		writeJSON(w, http.StatusInternalServerError, checkResponse{CheckResult: result, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, checkResponse{CheckResult: result})
+}
+
+// runStatusJSON runs checks on the local node or on remote nodes, as /status does
+func runStatusJSON(w http.ResponseWriter, r *http.Request) {
+	p, err := parseStatusParams(r)
+	if err == nil && p.iperf {
+		err = errors.New("iperf is not supported by the JSON API, use /iperf")
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s := newStreamWriter(w, r)
+	if p.hosts == utils.NodeName {
+		if !acquireLock(w, r, p.checks, s.progress()) {
+			return
+		}
+		defer utils.HealthcheckLock.Unlock()
+	}
+	if s != nil {
+		streamStatus(s, r, p)
+		return
+	}
+	response := statusResponse{Node: utils.NodeName}
+	if p.hosts != utils.NodeName {
+		klog.Info("Asking to run on remote node(s) ", p.hosts, " or with node label ", p.nodelabel)
+		nodes, err := healthcheck.RunHealthRemoteNodes(r.Context(), p.hosts, p.checks, p.batch, p.jobName, p.dcgmR, p.nodelabel)
+		response.Nodes = nodes
+		if err != nil {
+			klog.Error(err.Error())
+			response.Error = err.Error()
+			writeJSON(w, http.StatusInternalServerError, response)
+			return
+		}
+		writeJSON(w, http.StatusOK, response)
+		return
+	}
+
+	results, err := healthcheck.RunHealthLocalNode(r.Context(), p.checks, p.dcgmR, p.jobName, p.nodelabel, r)
+	response.Results = results
+	response.Failed = healthcheck.GetNodeStatus()
+	klog.Info("Errors after running local, on demand health checks: ", response.Failed)
+	utils.PatchNode(healthcheck.NodeHealthLabel(), utils.NodeName, false)
+	if err != nil {
+		klog.Error(err.Error())
+		response.Error = err.Error()
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// startRun runs checks in the background, with the same parameters as /status, and returns the new run.
+// Local runs hold the health check lock until they are done. If it is held, they fail with 409, or are queued
+// with the "wait" parameter, see acquireLock.
+func startRun(w http.ResponseWriter, r *http.Request) {
+	p, err := parseStatusParams(r)
+	if err == nil && p.iperf {
+		err = errors.New("iperf is not supported by the JSON API, use /iperf")
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var run healthcheck.Run
+	if p.hosts != utils.NodeName {
+		run = healthcheck.Runs.Start(p.checks, p.hosts, 0, func(ctx context.Context, run *healthcheck.Run) error {
+			// The run follows the nodes as they complete, see healthcheck.RunFunc
+			_, err := healthcheck.RunHealthRemoteNodes(ctx, p.hosts, p.checks, p.batch, p.jobName, p.dcgmR, p.nodelabel)
+			return err
+		})
+	} else {
+		holder, locked := utils.HealthcheckLock.TryLock(p.checks)
+		if !locked && !r.URL.Query().Has("wait") {
+			writeBusy(w, r, http.StatusConflict, holder)
+			return
+		}
+		if !locked && utils.HealthcheckLock.Waiting() >= healthcheck.GetCheckQueueSize() {
+			writeBusy(w, r, http.StatusTooManyRequests, holder)
+			return
+		}
+		checks := p.checks
+		if checks == "all" {
+			checks = healthcheck.GetPeriodicChecks()
+		}
+		// The request is done once the run is started, only its parameters are kept
+		req := r.Clone(context.Background())
+		start := healthcheck.Runs.Start
+		if !locked {
+			start = healthcheck.Runs.StartQueued
+		}
+		run = start(p.checks, p.hosts, len(strings.Split(checks, ",")), func(ctx context.Context, run *healthcheck.Run) error {
+			if !locked {
+				err := utils.HealthcheckLock.Wait(ctx, p.checks, -1, func(position int) {
+					healthcheck.Runs.SetQueued(run, position)
+				})
+				if err != nil {
+					return err
+				}
+				healthcheck.Runs.SetRunning(run)
+			}
+			defer utils.HealthcheckLock.Unlock()
+			_, err := healthcheck.RunHealthLocalNode(ctx, checks, p.dcgmR, p.jobName, p.nodelabel, req)
+			klog.Info("Errors after running local, on demand health checks: ", healthcheck.GetNodeStatus())
+			utils.PatchNode(healthcheck.NodeHealthLabel(), utils.NodeName, false)
+			return err
+		})
+	}
+	w.Header().Set("Location", APIPrefix+"runs/"+run.ID)
+	writeJSON(w, http.StatusAccepted, run)
+}
+
+// getRun returns the progress and the results of a run
+func getRun(w http.ResponseWriter, id string) {
+	run, found := healthcheck.Runs.Get(id)
+	if !found {
+		writeError(w, http.StatusNotFound, "run not found: "+id)
+		return
+	}
+	writeJSON(w, http.StatusOK, run)
+}
+
+// cancelRun cancels a running run, or deletes a finished one
+func cancelRun(w http.ResponseWriter, id string) {
+	run, found := healthcheck.Runs.Cancel(id)
+	if !found {
+		writeError(w, http.StatusNotFound, "run not found: "+id)
+		return
+	}
+	if !run.Finished.IsZero() {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, run)
+}
+
+func runInvasiveJSON(w http.ResponseWriter, r *http.Request) {
+	if !acquireLock(w, r, "invasive", nil) {
+		return
+	}
+	defer utils.HealthcheckLock.Unlock()
+	err := healthcheck.RunInvasiveCheck()
+	switch {
+	case errors.Is(err, healthcheck.ErrGPUsBusy):
+		writeError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeJSON(w, http.StatusAccepted, map[string]string{
+			"node":    utils.NodeName,
+			"message": "Invasive health checks launched. Results will be added to 'autopilot.ibm.com/gpuhealth' and 'autopilot.ibm.com/dcgm.level.3' node labels",
+		})
+	}
+}
+
+// acceptsJSON tells whether the client asked for JSON through the Accept header.
+// Clients accepting anything, like curl, keep the plain text output.
+func acceptsJSON(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediatype, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err == nil && mediatype == "application/json" {
+			return true
+		}
+	}
+	return false
+}
+
+// allowMethods writes a 405 error if the method of the request is not one of methods
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		klog.Error(err.Error())
+		code = http.StatusInternalServerError
+		out, _ = json.Marshal(apiError{Error: err.Error()})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(append(out, '\n'))
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, apiError{Error: message})
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/IBM/autopilot/pkg/healthcheck"
+	"github.com/IBM/autopilot/pkg/utils"
+)
+
+// apiCheck passes, unless it is asked to break
+type apiCheck struct{}
+
+func (apiCheck) Name() healthcheck.HealthCheck { return "apitest" }
+
+func (apiCheck) Run(ctx context.Context, params url.Values) (*healthcheck.CheckResult, error) {
+	result := &healthcheck.CheckResult{Check: "apitest", Status: healthcheck.StatusPass, Log: "all good\n"}
+	if params.Has("broken") {
+		return result, errors.New("cannot run")
+	}
+	return result, nil
+}
+
+func (apiCheck) Metadata() healthcheck.CheckMetadata {
+	return healthcheck.CheckMetadata{Description: "API test"}
+}
+
+func init() {
+	healthcheck.Register(apiCheck{})
+}
+
+// TestAPIHandler tests the status codes and bodies of the JSON API
+func TestAPIHandler(t *testing.T) {
+	api := APIHandler()
+	tests := []struct {
+		method string
+		target string
+		code   int
+		body   string
+	}{
+		{http.MethodGet, "/api/v1/checks", http.StatusOK, `"name": "apitest"`},
+		{http.MethodGet, "/api/v1/checks/apitest", http.StatusOK, `"description": "API test"`},
+		{http.MethodPost, "/api/v1/checks/apitest/run", http.StatusOK, `"status": "PASS"`},
+		{http.MethodPost, "/api/v1/checks/apitest/run?broken", http.StatusInternalServerError, `"error": "cannot run"`},
+		{http.MethodGet, "/api/v1/checks/apitest/run", http.StatusMethodNotAllowed, `"error"`},
+		{http.MethodPost, "/api/v1/checks/unknown/run", http.StatusNotFound, `"error"`},
+		{http.MethodPost, "/api/v1/status?check=apitest,unknown", http.StatusBadRequest, `not supported: unknown`},
+		{http.MethodPost, "/api/v1/status?check=iperf", http.StatusBadRequest, `"error"`},
+		{http.MethodPost, "/api/v1/status?check=apitest&host=worker_1", http.StatusBadRequest, `invalid host`},
+		{http.MethodPost, "/api/v1/checks/apitest/run?nodelabel=a%3D%3Db%3Dc", http.StatusBadRequest, `invalid nodelabel`},
+		{http.MethodPost, "/api/v1/report?check=apitest&format=xml", http.StatusBadRequest, `invalid format`},
+		{http.MethodGet, "/api/v1/report", http.StatusMethodNotAllowed, `"error"`},
+		{http.MethodGet, "/api/v1/history?since=yesterday", http.StatusBadRequest, `"error"`},
+		{http.MethodGet, "/api/v1/state", http.StatusOK, `"checks"`},
+		{http.MethodGet, "/api/v1/runs", http.StatusOK, `"runs"`},
+		{http.MethodPost, "/api/v1/runs?check=unknown", http.StatusBadRequest, `not supported: unknown`},
+		{http.MethodGet, "/api/v1/runs/unknown", http.StatusNotFound, `"error"`},
+		{http.MethodPut, "/api/v1/runs/unknown", http.StatusMethodNotAllowed, `"error"`},
+		{http.MethodGet, "/api/v1/unknown", http.StatusNotFound, `"error"`},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, httptest.NewRequest(test.method, test.target, nil))
+		if w.Code != test.code || !strings.Contains(w.Body.String(), test.body) {
+			t.Errorf("%s %s: expected %d with %s, got %d with %s", test.method, test.target, test.code, test.body, w.Code, w.Body.String())
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s %s: expected JSON, got %s", test.method, test.target, ct)
+		}
+	}
+
+	// Busy, with and without a place in the queue
+	t.Setenv("CHECK_QUEUE_SIZE", "0")
+	utils.HealthcheckLock.Lock("pciebw")
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/checks/apitest/run", nil))
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), `"checks": "pciebw"`) {
+		t.Errorf("Expected %d with the running check, got %d with %s", http.StatusConflict, w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	api.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/checks/apitest/run?wait", nil))
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected %d with a full queue, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	utils.HealthcheckLock.Unlock()
+}
+
+// TestCheckHandlerNegotiation tests that the check endpoints keep their text output, unless JSON is requested
+func TestCheckHandlerNegotiation(t *testing.T) {
+	c, _ := healthcheck.GetChecker("apitest")
+	h := CheckHandler(c)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/apitest", nil)
+	r.Header.Set("Accept", "*/*")
+	h.ServeHTTP(w, r)
+	if w.Body.String() != "API test\nall good\n" {
+		t.Errorf("Expected the text output, got %q", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/apitest", nil)
+	r.Header.Set("Accept", "application/json; charset=utf-8")
+	h.ServeHTTP(w, r)
+	result := healthcheck.CheckResult{}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil || result.Status != healthcheck.StatusPass {
+		t.Errorf("Expected a JSON result, got %q", w.Body.String())
+	}
+}
+
+// TestCheckHandlerStream tests that the check endpoints stream as plain text or as events when asked to
+func TestCheckHandlerStream(t *testing.T) {
+	c, _ := healthcheck.GetChecker("apitest")
+	h := CheckHandler(c)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/apitest?stream", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Expected plain text, got %s", ct)
+	}
+	if !strings.HasPrefix(w.Body.String(), "API test\nHealth check apitest completed with status PASS") || !w.Flushed {
+		t.Errorf("Expected the streamed status, got %q", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/apitest?broken", nil)
+	r.Header.Set("Accept", "text/event-stream")
+	h.ServeHTTP(w, r)
+	if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected events, got %s", ct)
+	}
+	for _, event := range []string{"event: output\ndata: {", "event: result\ndata: {\"check\":\"apitest\",\"status\":\"ERROR\"", "event: done\ndata: {\"node\":\"" + utils.NodeName + "\",\"error\":\"cannot run\"}\n\n"} {
+		if !strings.Contains(w.Body.String(), event) {
+			t.Errorf("Expected %q in the events, got %q", event, w.Body.String())
+		}
+	}
+}
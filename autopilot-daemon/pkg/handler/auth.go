@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IBM/autopilot/pkg/healthcheck"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// Verbs of the SubjectAccessReviews. Endpoints that only read the state of the node are authorized with "get",
+// endpoints that run checks, start iperf servers or change anything else with "post", whatever the HTTP method.
+const (
+	verbRead   = "get"
+	verbModify = "post"
+)
+
+// Authorizer authenticates the requests with the bearer token of their Authorization header, through the
+// TokenReview API, and authorizes them per endpoint through the SubjectAccessReview API, with the path of the
+// endpoint as non-resource URL. Runs through other endpoints, like /status, are also authorized on the path of each check.
+// Reviews are cached for ttl.
+type Authorizer struct {
+	client kubernetes.Interface
+	ttl    time.Duration
+
+	lock      sync.Mutex
+	users     map[string]cachedUser
+	decisions map[string]cachedDecision
+}
+
+type cachedUser struct {
+	user    *authenticationv1.UserInfo
+	expires time.Time
+}
+
+type cachedDecision struct {
+	allowed bool
+	expires time.Time
+}
+
+func NewAuthorizer(client kubernetes.Interface, ttl time.Duration) *Authorizer {
+	return &Authorizer{
+		client:    client,
+		ttl:       ttl,
+		users:     make(map[string]cachedUser),
+		decisions: make(map[string]cachedDecision),
+	}
+}
+
+// Handler returns next, behind authentication and authorization. Failures are answered with 401 or 403.
+func (a *Authorizer) Handler(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="autopilot"`)
+			authError(w, r, http.StatusUnauthorized, "a bearer token is required")
+			return
+		}
+		user, err := a.authenticate(r.Context(), token)
+		if err != nil {
+			klog.Error("Cannot review token: ", err.Error())
+			authError(w, r, http.StatusInternalServerError, "cannot review the token")
+			return
+		}
+		if user == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="autopilot", error="invalid_token"`)
+			authError(w, r, http.StatusUnauthorized, "invalid bearer token")
+			return
+		}
+		for _, attributes := range accessAttributes(r) {
+			allowed, err := a.authorize(r.Context(), user, attributes)
+			if err != nil {
+				klog.Error("Cannot review access: ", err.Error())
+				authError(w, r, http.StatusInternalServerError, "cannot review the access")
+				return
+			}
+			if !allowed {
+				klog.Info("Access denied to ", user.Username, ": ", attributes.Verb, " ", attributes.Path)
+				authError(w, r, http.StatusForbidden, "user "+user.Username+" cannot "+attributes.Verb+" "+attributes.Path)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// authenticate returns the user of a token, or nil if the token is not valid
+func (a *Authorizer) authenticate(ctx context.Context, token string) (*authenticationv1.UserInfo, error) {
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:])
+	a.lock.Lock()
+	cached, found := a.users[key]
+	a.lock.Unlock()
+	if found && time.Now().Before(cached.expires) {
+		return cached.user, nil
+	}
+	review, err := a.client.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var user *authenticationv1.UserInfo
+	if review.Status.Authenticated {
+		user = &review.Status.User
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	for k, c := range a.users {
+		if time.Now().After(c.expires) {
+			delete(a.users, k)
+		}
+	}
+	a.users[key] = cachedUser{user: user, expires: time.Now().Add(a.ttl)}
+	return user, nil
+}
+
+// authorize tells whether a user can access an endpoint
+func (a *Authorizer) authorize(ctx context.Context, user *authenticationv1.UserInfo, attributes authorizationv1.NonResourceAttributes) (bool, error) {
+	key := user.UID + "\x00" + user.Username + "\x00" + strings.Join(user.Groups, ",") + "\x00" + attributes.Verb + "\x00" + attributes.Path
+	a.lock.Lock()
+	cached, found := a.decisions[key]
+	a.lock.Unlock()
+	if found && time.Now().Before(cached.expires) {
+		return cached.allowed, nil
+	}
+	extra := map[string]authorizationv1.ExtraValue{}
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	review, err := a.client.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:                  user.Username,
+			UID:                   user.UID,
+			Groups:                user.Groups,
+			Extra:                 extra,
+			NonResourceAttributes: &attributes,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return false, err
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	for k, c := range a.decisions {
+		if time.Now().After(c.expires) {
+			delete(a.decisions, k)
+		}
+	}
+	a.decisions[key] = cachedDecision{allowed: review.Status.Allowed, expires: time.Now().Add(a.ttl)}
+	return review.Status.Allowed, nil
+}
+
+// accessAttributes returns the endpoints, with their verb, that a request must be authorized on
+func accessAttributes(r *http.Request) []authorizationv1.NonResourceAttributes {
+	p := path.Clean("/" + r.URL.Path)
+	if isReadOnly(r.Method, p) {
+		return []authorizationv1.NonResourceAttributes{{Path: p, Verb: verbRead}}
+	}
+	attributes := []authorizationv1.NonResourceAttributes{{Path: p, Verb: verbModify}}
+	checks := []string{}
+	switch p {
+	case "/status", "/report", path.Clean(APIPrefix + "status"), path.Clean(APIPrefix + "report"), path.Clean(APIPrefix + "runs"):
+		checks = selectedChecks(r.URL.Query().Get("check"))
+	}
+	if check, found := strings.CutPrefix(p, APIPrefix+"checks/"); found {
+		checks = []string{strings.TrimSuffix(check, "/run")}
+	}
+	for _, check := range checks {
+		attributes = append(attributes, authorizationv1.NonResourceAttributes{Path: "/" + check, Verb: verbModify})
+	}
+	return attributes
+}
+
+// isReadOnly tells whether an endpoint only reads the state of the node
+func isReadOnly(method string, p string) bool {
+	switch p {
+	case "/state", "/history":
+		return true
+	}
+	return strings.HasPrefix(p, APIPrefix) && (method == http.MethodGet || method == http.MethodHead)
+}
+
+// selectedChecks returns the checks of the "check" parameter of /status, "all" standing for the periodic checks
+func selectedChecks(checks string) []string {
+	if checks == "" {
+		checks = "all"
+	}
+	return healthcheck.ExpandChecks(checks)
+}
+
+func authError(w http.ResponseWriter, r *http.Request, code int, message string) {
+	if strings.HasPrefix(r.URL.Path, APIPrefix) || acceptsJSON(r) {
+		writeError(w, code, message)
+		return
+	}
+	http.Error(w, message, code)
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// TestAuthorizer tests authentication and per endpoint authorization, with a reader allowed to get anything
+// and to run the apitest check only
+func TestAuthorizer(t *testing.T) {
+	t.Setenv("PERIODIC_CHECKS", "apitest")
+	client := fake.NewSimpleClientset()
+	reviews := 0
+	client.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		reviews++
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		if review.Spec.Token == "reader-token" {
+			review.Status = authenticationv1.TokenReviewStatus{Authenticated: true, User: authenticationv1.UserInfo{Username: "reader"}}
+		}
+		return true, review, nil
+	})
+	client.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		attributes := review.Spec.NonResourceAttributes
+		review.Status.Allowed = review.Spec.User == "reader" &&
+			(attributes.Verb == verbRead || attributes.Path == "/apitest" || attributes.Path == "/status" || attributes.Path == "/api/v1/checks/pvc/run")
+		return true, review, nil
+	})
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := NewAuthorizer(client, time.Minute).Handler(next)
+
+	tests := []struct {
+		method string
+		target string
+		token  string
+		code   int
+	}{
+		{http.MethodGet, "/state", "", http.StatusUnauthorized},
+		{http.MethodGet, "/state", "invalid-token", http.StatusUnauthorized},
+		{http.MethodGet, "/state", "reader-token", http.StatusOK},
+		{http.MethodGet, "/api/v1/history", "reader-token", http.StatusOK},
+		{http.MethodGet, "/apitest", "reader-token", http.StatusOK},
+		{http.MethodGet, "/status?check=apitest", "reader-token", http.StatusOK},
+		{http.MethodGet, "/status?check=apitest,pvc", "reader-token", http.StatusForbidden},
+		{http.MethodGet, "/status?check=all", "reader-token", http.StatusOK},
+		{http.MethodGet, "/status?check=all,iperf", "reader-token", http.StatusForbidden},
+		{http.MethodGet, "/invasive", "reader-token", http.StatusForbidden},
+		{http.MethodGet, "/iperfservers", "reader-token", http.StatusForbidden},
+		{http.MethodPost, "/api/v1/invasive", "reader-token", http.StatusForbidden},
+		{http.MethodPost, "/api/v1/checks/pvc/run", "reader-token", http.StatusForbidden},
+		{http.MethodDelete, "/api/v1/runs/0123", "reader-token", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(test.method, test.target, nil)
+		if test.token != "" {
+			r.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		h.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("%s %s with %q: expected %d, got %d", test.method, test.target, test.token, test.code, w.Code)
+		}
+	}
+	// Tokens are reviewed once, then cached
+	if reviews != 2 {
+		t.Errorf("Expected 2 token reviews, got %d", reviews)
+	}
+}
@@ -2,94 +2,135 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
-	"strconv"
+	"net/url"
 	"strings"
+	"time"
 
 	"github.com/IBM/autopilot/pkg/healthcheck"
 	"github.com/IBM/autopilot/pkg/utils"
 	"k8s.io/klog/v2"
 )
 
+// statusParams are the parameters of /status, with their defaults
+type statusParams struct {
+	nodelabel string
+	hosts     string
+	checks    string
+	batch     string
+	jobName   string
+	dcgmR     string
+	// Whether iperf was requested, it is not part of checks
+	iperf bool
+}
+
+// parseStatusParams parses and validates the parameters of /status, see validateCheckParams
+func parseStatusParams(r *http.Request) (statusParams, error) {
+	p := statusParams{
+		nodelabel: r.URL.Query().Get("nodelabel"),
+		hosts:     r.URL.Query().Get("host"),
+		checks:    r.URL.Query().Get("check"),
+		batch:     r.URL.Query().Get("batch"),
+		jobName:   r.URL.Query().Get("job"),
+		dcgmR:     r.URL.Query().Get("r"),
+	}
+	if p.nodelabel == "" {
+		p.nodelabel = "None"
+	}
+	if p.hosts == "" {
+		p.hosts = "all"
+	}
+	if p.checks == "" {
+		p.checks = "all"
+	}
+	if p.batch == "" {
+		p.batch = "0"
+	}
+	if p.jobName == "" {
+		p.jobName = "None"
+	}
+	if p.dcgmR == "" {
+		p.dcgmR = "1"
+	}
+	checks, iperf, err := parseChecks(p.checks)
+	if err != nil {
+		return p, err
+	}
+	p.checks, p.iperf = checks, iperf
+	return p, validateCheckParams(r.URL.Query())
+}
+
+// SystemStatusHandler runs health checks on the local node or on remote nodes. The output is plain text,
+// unless the client accepts JSON, in which case the response is the same as /api/v1/status.
+// The output is streamed while the checks run if the client asks for it, see newStreamWriter.
 func SystemStatusHandler() http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
-		nodelabel := r.URL.Query().Get("nodelabel")
-		if nodelabel == "" {
-			nodelabel = "None"
-		}
-		hosts := r.URL.Query().Get("host")
-		if hosts == "" {
-			hosts = "all"
-		}
-		checks := r.URL.Query().Get("check")
-		if checks == "" {
-			checks = "all"
-		}
-		batch := r.URL.Query().Get("batch")
-		if batch == "" {
-			batch = "0"
+		if acceptsJSON(r) {
+			runStatusJSON(w, r)
+			return
 		}
-		jobName := r.URL.Query().Get("job")
-		if jobName == "" {
-			jobName = "None"
-		}
-		dcgmR := r.URL.Query().Get("r")
-		if dcgmR == "" {
-			dcgmR = "1"
-		}
-		if strings.Contains(checks, string(healthcheck.Iperf)) {
-			klog.Info("Running iperf3 on hosts ", hosts, " or job ", jobName)
-			w.Write([]byte("Running iperf3 on hosts " + hosts + " or job " + jobName + "\n\n"))
-			checks = strings.Trim(checks, "iperf")
-			workload := r.URL.Query().Get("workload")
-			if workload == "" {
-				workload = "ring"
-			}
-			pclients := r.URL.Query().Get("pclients")
-			if pclients == "" {
-				pclients = "8"
-			}
-			startport := r.URL.Query().Get("startport")
-			if startport == "" {
-				startport = "5200"
-			}
-			cleanup := ""
-			if r.URL.Query().Has("cleanup") {
-				cleanup = "--cleanup"
-			}
-			out, err := healthcheck.RunIperf(workload, pclients, startport, cleanup)
-			if err != nil {
-				klog.Error(err.Error())
+		p, err := parseStatusParams(r)
+		if err != nil {
+			writeParamError(w, r, err)
+			return
+		}
+		var ip iperfParams
+		if p.iperf {
+			if ip, err = parseIperfParams(r); err != nil {
+				writeParamError(w, r, err)
+				return
 			}
-			if out != nil {
-				w.Write(*out)
+		}
+		var out io.Writer = w
+		s := newStreamWriter(w, r)
+		if s != nil {
+			out = s
+		}
+		if p.iperf {
+			klog.Info("Running iperf3 on hosts ", p.hosts, " or job ", p.jobName)
+			out.Write([]byte("Running iperf3 on hosts " + p.hosts + " or job " + p.jobName + "\n\n"))
+			iperfOut, err := healthcheck.RunIperf(r.Context(), ip.workload, ip.pclients, ip.startport, ip.cleanup)
+			writeIperfOutput(out, iperfOut, err)
+		}
+		if p.checks != "" && s != nil {
+			if p.hosts == utils.NodeName {
+				if !acquireLock(w, r, p.checks, s.progress()) {
+					return
+				}
+				defer utils.HealthcheckLock.Unlock()
 			}
+			streamStatus(s, r, p)
+			return
 		}
-		if checks != "" {
-			if hosts == utils.NodeName {
-				utils.HealthcheckLock.Lock()
+		if p.checks != "" {
+			if p.hosts == utils.NodeName {
+				if !acquireLock(w, r, p.checks, textProgress(w)) {
+					return
+				}
 				defer utils.HealthcheckLock.Unlock()
-				out, err := healthcheck.RunHealthLocalNode(checks, dcgmR, jobName, nodelabel, r)
+				results, err := healthcheck.RunHealthLocalNode(r.Context(), p.checks, p.dcgmR, p.jobName, p.nodelabel, r)
 				if err != nil {
 					klog.Error(err.Error())
 				}
-				w.Write(*out)
-				hasFailures := healthcheck.GetNodeStatus()
-				klog.Info("Errors after running local, on demand health checks: ", hasFailures)
-				if hasFailures {
-					utils.PatchNode(utils.GPUHealthWarnLabel, utils.NodeName, false)
-				} else {
-					utils.PatchNode(utils.GPUHealthPassLabel, utils.NodeName, false)
+				for _, result := range results {
+					w.Write([]byte(result.Log))
 				}
+				klog.Info("Errors after running local, on demand health checks: ", healthcheck.GetNodeStatus())
+				utils.PatchNode(healthcheck.NodeHealthLabel(), utils.NodeName, false)
 
 			} else {
-				klog.Info("Asking to run on remote node(s) ", hosts, " or with node label ", nodelabel)
-				w.Write([]byte("Asking to run on remote node(s) " + hosts + " or with node label " + nodelabel + "\n\n"))
-				out, err := healthcheck.RunHealthRemoteNodes(hosts, checks, batch, jobName, dcgmR, nodelabel)
+				klog.Info("Asking to run on remote node(s) ", p.hosts, " or with node label ", p.nodelabel)
+				w.Write([]byte("Asking to run on remote node(s) " + p.hosts + " or with node label " + p.nodelabel + "\n\n"))
+				nodes, err := healthcheck.RunHealthRemoteNodes(r.Context(), p.hosts, p.checks, p.batch, p.jobName, p.dcgmR, p.nodelabel)
+				if nodes != nil {
+					w.Write(healthcheck.FormatNodeResults(nodes))
+				}
 				if err != nil {
 					klog.Error(err.Error())
+					w.Write([]byte("Error: " + err.Error() + "\n"))
 				}
-				w.Write(*out)
 			}
 		}
 
@@ -97,96 +138,159 @@ func SystemStatusHandler() http.Handler {
 	return http.HandlerFunc(fn)
 }
 
-func PCIeBWHandler() http.Handler {
+// CheckHandler runs a single registered health check on the local node. The output is plain text,
+// unless the client accepts JSON, in which case the response is the same as /api/v1/checks/<name>/run.
+// The output is streamed while the check runs if the client asks for it, see newStreamWriter.
+func CheckHandler(c healthcheck.Checker) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte("Requesting pcie test with bw: " + strconv.Itoa(utils.UserConfig.BWThreshold) + "\n"))
-		out, err := healthcheck.RunPCIeBW()
+		if acceptsJSON(r) {
+			runCheckJSON(w, r, c)
+			return
+		}
+		if err := validateCheckParams(r.URL.Query()); err != nil {
+			writeParamError(w, r, err)
+			return
+		}
+		s := newStreamWriter(w, r)
+		if s != nil {
+			if !acquireLock(w, r, string(c.Name()), s.progress()) {
+				return
+			}
+			defer utils.HealthcheckLock.Unlock()
+			s.Write([]byte(c.Metadata().Description + "\n"))
+			streamCheck(s, r, c)
+			return
+		}
+		if !acquireLock(w, r, string(c.Name()), textProgress(w)) {
+			return
+		}
+		defer utils.HealthcheckLock.Unlock()
+		w.Write([]byte(c.Metadata().Description + "\n"))
+		result, err := healthcheck.RunCheck(r.Context(), c, checkParams(r))
 		if err != nil {
 			klog.Error(err.Error())
 		}
-		if out != nil {
-			w.Write(*out)
-		}
-
+		w.Write([]byte(result.Log))
 	}
 	return http.HandlerFunc(fn)
 }
 
-func RemappedRowsHandler() http.Handler {
-	fn := func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte("Requesting Remapped Rows check on all GPUs\n"))
-		out, err := healthcheck.RunRemappedRows()
-		if err != nil {
-			klog.Error(err.Error())
+// checkParams returns the parameters of a request passed to the checks, without the ones of the handlers
+func checkParams(r *http.Request) url.Values {
+	params := r.URL.Query()
+	params.Del("stream")
+	params.Del("wait")
+	return params
+}
+
+// StateHandler returns the state of the health checks of the node, as JSON.
+// The "check" parameter restricts the output to a comma separated list of checks.
+func StateHandler() http.Handler {
+	return http.HandlerFunc(writeState)
+}
+
+func writeState(w http.ResponseWriter, r *http.Request) {
+	states := healthcheck.State.List()
+	if checks := r.URL.Query().Get("check"); checks != "" {
+		selected := []healthcheck.CheckState{}
+		for _, check := range strings.Split(checks, ",") {
+			if state, found := healthcheck.State.Get(healthcheck.HealthCheck(check)); found {
+				selected = append(selected, state)
+			}
 		}
-		if out != nil {
-			w.Write(*out)
+		states = selected
+	}
+	state := map[string]interface{}{
+		"node":    utils.NodeName,
+		"failed":  healthcheck.GetNodeStatus(),
+		"checks":  states,
+		"waiting": utils.HealthcheckLock.Waiting(),
+	}
+	if holder, held := utils.HealthcheckLock.Holder(); held {
+		state["running"] = holder
+	}
+	writeJSON(w, http.StatusOK, state)
+}
+
+// HistoryHandler returns the results of the last runs of the health checks of the node, as JSON, sorted by start time.
+// The "check" parameter restricts the output to a comma separated list of checks. The "since" and "until" parameters
+// restrict it to a time range, either as RFC 3339 timestamps or as intervals before now (e.g., since=24h).
+func HistoryHandler() http.Handler {
+	return http.HandlerFunc(writeHistory)
+}
+
+func writeHistory(w http.ResponseWriter, r *http.Request) {
+	checks := []healthcheck.HealthCheck{}
+	if list := r.URL.Query().Get("check"); list != "" {
+		for _, check := range strings.Split(list, ",") {
+			checks = append(checks, healthcheck.HealthCheck(check))
 		}
+	}
+	since, err := parseTime(r.URL.Query().Get("since"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid since: "+err.Error())
+		return
+	}
+	until, err := parseTime(r.URL.Query().Get("until"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid until: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"node":    utils.NodeName,
+		"results": healthcheck.History.List(checks, since, until),
+	})
+}
 
+// parseTime parses an RFC 3339 timestamp, or an interval before now. An empty value is the zero time.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
 	}
-	return http.HandlerFunc(fn)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	d, err := utils.ParseInterval(value)
+	if err != nil {
+		return time.Time{}, errors.New("must be an RFC 3339 timestamp or an interval")
+	}
+	return time.Now().Add(-d), nil
 }
 
-func PingHandler() http.Handler {
+func InvasiveCheckHandler() http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte("Ping test"))
-		hosts := r.URL.Query().Get("host")
-		if hosts == "" {
-			hosts = "all"
-		}
-		jobName := r.URL.Query().Get("job")
-		if jobName == "" {
-			jobName = "None"
-		}
-		nodelabel := r.URL.Query().Get("nodelabel")
-		if nodelabel == "" {
-			nodelabel = "None"
+		if !acquireLock(w, r, "invasive", textProgress(w)) {
+			return
 		}
-		out, err := healthcheck.RunPing(hosts, jobName, nodelabel)
-		if err != nil {
+		defer utils.HealthcheckLock.Unlock()
+		w.Write([]byte("Launching invasive health checks. Results will be added to 'autopilot.ibm.com/gpuhealth' and 'autopilot.ibm.com/dcgm.level.3' node labels\n"))
+		if err := healthcheck.RunInvasiveCheck(); err != nil {
 			klog.Error(err.Error())
-		}
-		if out != nil {
-			w.Write(*out)
+			w.Write([]byte(err.Error() + "\n"))
 		}
 	}
 	return http.HandlerFunc(fn)
 }
 
-func InvasiveCheckHandler() http.Handler {
-	fn := func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte("Launching invasive health checks. Results will be added to 'autopilot.ibm.com/gpuhealth' and 'autopilot.ibm.com/dcgm.level.3' node labels\n"))
-		healthcheck.InvasiveCheck()
+// writeIperfOutput writes the output of an iperf script, followed by its error, if any
+func writeIperfOutput(w io.Writer, out *[]byte, err error) {
+	if out != nil {
+		w.Write(*out)
+	}
+	if err != nil {
+		w.Write([]byte("Error: " + err.Error() + "\n"))
 	}
-	return http.HandlerFunc(fn)
 }
 
 func IperfHandler() http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
-
-		workload := r.URL.Query().Get("workload")
-		if workload == "" {
-			workload = "ring"
-		}
-		pclients := r.URL.Query().Get("pclients")
-		if pclients == "" {
-			pclients = "8"
-		}
-		startport := r.URL.Query().Get("startport")
-		if startport == "" {
-			startport = "5200"
-		}
-		cleanup := ""
-		if r.URL.Query().Has("cleanup") {
-			cleanup = "--cleanup"
-		}
-		out, err := healthcheck.RunIperf(workload, pclients, startport, cleanup)
+		p, err := parseIperfParams(r)
 		if err != nil {
-			klog.Error(err.Error())
-		}
-		if out != nil {
-			w.Write(*out)
+			writeParamError(w, r, err)
+			return
 		}
+		out, err := healthcheck.RunIperf(r.Context(), p.workload, p.pclients, p.startport, p.cleanup)
+		writeIperfOutput(w, out, err)
 	}
 	return http.HandlerFunc(fn)
 }
@@ -201,27 +305,24 @@ func StartIperfServersHandler() http.Handler {
 		if startport == "" {
 			startport = "5200"
 		}
-		out, err := healthcheck.StartIperfServers(numservers, startport)
-
-		if err != nil {
-			klog.Error(err.Error())
+		n, err := parseInt("numservers", numservers, 1, 1024)
+		if err == nil {
+			err = validatePorts("startport", startport, n)
 		}
-		if out != nil {
-			w.Write(*out)
+		if err != nil {
+			writeParamError(w, r, err)
+			return
 		}
+		out, err := healthcheck.StartIperfServers(r.Context(), numservers, startport)
+		writeIperfOutput(w, out, err)
 	}
 	return http.HandlerFunc(fn)
 }
 
 func StopAllIperfServersHandler() http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
-		out, err := healthcheck.StopAllIperfServers()
-		if err != nil {
-			klog.Error(err.Error())
-		}
-		if out != nil {
-			w.Write(*out)
-		}
+		out, err := healthcheck.StopAllIperfServers(r.Context())
+		writeIperfOutput(w, out, err)
 	}
 	return http.HandlerFunc(fn)
 }
@@ -231,73 +332,19 @@ func StartIperfClientsHandler() http.Handler {
 		dstip := r.URL.Query().Get("dstip")
 		dstport := r.URL.Query().Get("dstport")
 		numclients := r.URL.Query().Get("numclients")
-		out, err := healthcheck.StartIperfClients(dstip, dstport, numclients)
-		if err != nil {
-			klog.Error(err.Error())
-		}
-		if out != nil {
-			w.Write(*out)
-		}
-	}
-	return http.HandlerFunc(fn)
-}
-
-func DCGMHandler() http.Handler {
-	fn := func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte("DCGM test"))
-		dcgmR := r.URL.Query().Get("r")
-		if dcgmR == "" {
-			dcgmR = "1"
-		}
-		out, err := healthcheck.RunDCGM(dcgmR)
-		if err != nil {
-			klog.Error(err.Error())
-		}
-		if out != nil {
-			w.Write(*out)
-		}
-	}
-	return http.HandlerFunc(fn)
-}
-
-func GpuPowerHandler() http.Handler {
-	fn := func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte("GPU Power Measurement test"))
-		out, err := healthcheck.RunGPUPower()
-		if err != nil {
-			klog.Error(err.Error())
-		}
-		if out != nil {
-			w.Write(*out)
+		err := validateIP("dstip", dstip)
+		if err == nil {
+			_, err = parseInt("dstport", dstport, 1, 65535)
 		}
-	}
-	return http.HandlerFunc(fn)
-}
-
-func GpuMemHandler() http.Handler {
-	fn := func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte("GPU Memory DGEMM+DAXPY test"))
-		out, err := healthcheck.RunGPUPower()
-		if err != nil {
-			klog.Error(err.Error())
-		}
-		if out != nil {
-			w.Write(*out)
+		if err == nil {
+			_, err = parseInt("numclients", numclients, 1, 1024)
 		}
-	}
-	return http.HandlerFunc(fn)
-}
-
-func PVCHandler() http.Handler {
-	fn := func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte("PVC create-delete test\n"))
-		out, err := healthcheck.RunCreateDeletePVC()
 		if err != nil {
-			klog.Error(err.Error())
-		}
-		if out != nil {
-			w.Write(*out)
+			writeParamError(w, r, err)
+			return
 		}
+		out, err := healthcheck.StartIperfClients(r.Context(), dstip, dstport, numclients)
+		writeIperfOutput(w, out, err)
 	}
 	return http.HandlerFunc(fn)
 }
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/IBM/autopilot/pkg/healthcheck"
+	"github.com/IBM/autopilot/pkg/utils"
+)
+
+// busyResponse is returned when other health checks hold the lock of the node
+type busyResponse struct {
+	Error   string           `json:"error"`
+	Running utils.LockHolder `json:"running"`
+}
+
+// acquireLock takes the health check lock for checks. By default, it fails right away with 409 and the running checks
+// if the lock is held. With the "wait" parameter, the request waits in a FIFO queue instead, and progress (if not nil)
+// is called whenever its position changes. A full queue fails with 429. Returns whether the lock was taken.
+func acquireLock(w http.ResponseWriter, r *http.Request, checks string, progress func(int, utils.LockHolder)) bool {
+	if !r.URL.Query().Has("wait") {
+		holder, locked := utils.HealthcheckLock.TryLock(checks)
+		if !locked {
+			writeBusy(w, r, http.StatusConflict, holder)
+		}
+		return locked
+	}
+	err := utils.HealthcheckLock.Wait(r.Context(), checks, healthcheck.GetCheckQueueSize(), func(position int) {
+		if holder, held := utils.HealthcheckLock.Holder(); held && progress != nil {
+			progress(position, holder)
+		}
+	})
+	if errors.Is(err, utils.ErrQueueFull) {
+		holder, _ := utils.HealthcheckLock.Holder()
+		writeBusy(w, r, http.StatusTooManyRequests, holder)
+	}
+	return err == nil
+}
+
+func writeBusy(w http.ResponseWriter, r *http.Request, code int, holder utils.LockHolder) {
+	message := "another health check is running"
+	if code == http.StatusTooManyRequests {
+		message = utils.ErrQueueFull.Error()
+	}
+	if strings.HasPrefix(r.URL.Path, APIPrefix) || acceptsJSON(r) {
+		writeJSON(w, code, busyResponse{Error: message, Running: holder})
+		return
+	}
+	http.Error(w, fmt.Sprintf("Busy, %s: %s since %s", message, holder.Checks, holder.Since.Format(time.RFC3339)), code)
+}
+
+// queuedMessage describes the position of a request in the queue
+func queuedMessage(position int, holder utils.LockHolder) string {
+	return fmt.Sprintf("Waiting in the queue at position %d, %s running since %s\n", position, holder.Checks, holder.Since.Format(time.RFC3339))
+}
+
+// textProgress writes the position of a request in the queue to a plain text response
+func textProgress(w http.ResponseWriter) func(int, utils.LockHolder) {
+	return func(position int, holder utils.LockHolder) {
+		w.Write([]byte(queuedMessage(position, holder)))
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+	}
+}
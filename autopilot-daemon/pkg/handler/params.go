@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/IBM/autopilot/pkg/healthcheck"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// The query parameters end up in the arguments of the checks and of the scripts they run, so they are validated
+// before any of them is used. Invalid values are answered with 400.
+
+// Values of "r": a DCGM run level, or a comma separated list of DCGM tests
+var dcgmRunPattern = regexp.MustCompile(`^([1-4]|[a-z][a-z0-9_]*(,[a-z][a-z0-9_]*)*)$`)
+
+// Supported values of "workload"
+var iperfWorkloads = []string{"ring"}
+
+type paramError struct {
+	key    string
+	value  string
+	reason string
+}
+
+func (e *paramError) Error() string {
+	return fmt.Sprintf("invalid %s %q: %s", e.key, e.value, e.reason)
+}
+
+// parseChecks parses a comma separated list of "all" and the names of registered checks and iperf.
+// Returns the checks without iperf, and whether iperf was requested. "all" stands for the periodic checks: it is kept
+// as is when alone, and expanded in place when other checks are listed with it.
+func parseChecks(value string) (string, bool, error) {
+	checks := []string{}
+	iperf := false
+	all, named := false, false
+	for _, check := range strings.Split(value, ",") {
+		switch check {
+		case string(healthcheck.Iperf):
+			iperf = true
+			continue
+		case "all":
+			all = true
+		default:
+			if _, found := healthcheck.GetChecker(healthcheck.HealthCheck(check)); !found {
+				return "", false, &paramError{"check", value, "health check not supported: " + check}
+			}
+			named = true
+		}
+		checks = append(checks, check)
+	}
+	if all && !named {
+		return "all", iperf, nil
+	}
+	expanded := []string{}
+	listed := make(map[string]bool)
+	for _, check := range healthcheck.ExpandChecks(strings.Join(checks, ",")) {
+		if !listed[check] {
+			listed[check] = true
+			expanded = append(expanded, check)
+		}
+	}
+	return strings.Join(expanded, ","), iperf, nil
+}
+
+// validateNodes checks "all" or a comma separated list of node names, which are RFC 1123 subdomains
+func validateNodes(key string, value string) error {
+	if value == "all" {
+		return nil
+	}
+	for _, node := range strings.Split(value, ",") {
+		if errs := validation.IsDNS1123Subdomain(node); len(errs) > 0 {
+			return &paramError{key, value, "node " + node + ": " + strings.Join(errs, ", ")}
+		}
+	}
+	return nil
+}
+
+func validateSelector(key string, value string) error {
+	if _, err := labels.Parse(value); err != nil {
+		return &paramError{key, value, err.Error()}
+	}
+	return nil
+}
+
+// validateJob checks a workload as namespace:label-selector
+func validateJob(value string) error {
+	namespace, selector, found := strings.Cut(value, ":")
+	if !found || selector == "" {
+		return &paramError{"job", value, "must be namespace:label-key=label-value"}
+	}
+	if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+		return &paramError{"job", value, "namespace " + namespace + ": " + strings.Join(errs, ", ")}
+	}
+	return validateSelector("job", selector)
+}
+
+func parseInt(key string, value string, min int, max int) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || n > max {
+		return 0, &paramError{key, value, fmt.Sprintf("must be an integer from %d to %d", min, max)}
+	}
+	return n, nil
+}
+
+// validatePorts checks count consecutive ports from start, as used by the iperf servers and clients
+func validatePorts(key string, start string, count int) error {
+	port, err := parseInt(key, start, 1, 65535)
+	if err != nil {
+		return err
+	}
+	if port+count-1 > 65535 {
+		return &paramError{key, start, fmt.Sprintf("the range of %d ports ends after 65535", count)}
+	}
+	return nil
+}
+
+func validateIP(key string, value string) error {
+	if net.ParseIP(value) == nil {
+		return &paramError{key, value, "must be an IP address"}
+	}
+	return nil
+}
+
+// validateCheckParams checks the parameters passed to the checks, see the checkers in the healthcheck package.
+// Other parameters reach custom checks as environment variables only.
+func validateCheckParams(params url.Values) error {
+	for _, key := range []string{"host", "pingnodes"} {
+		if params.Has(key) {
+			if err := validateNodes(key, params.Get(key)); err != nil {
+				return err
+			}
+		}
+	}
+	if value := params.Get("job"); value != "" && value != "None" {
+		if err := validateJob(value); err != nil {
+			return err
+		}
+	}
+	if value := params.Get("nodelabel"); value != "" && value != "None" {
+		if err := validateSelector("nodelabel", value); err != nil {
+			return err
+		}
+	}
+	if value := params.Get("r"); value != "" && !dcgmRunPattern.MatchString(value) {
+		return &paramError{"r", value, "must be a run level from 1 to 4, or a comma separated list of DCGM tests"}
+	}
+	if value := params.Get("batch"); value != "" {
+		if _, err := parseInt("batch", value, 0, 1000000); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// iperfParams are the parameters of /iperf, with their defaults
+type iperfParams struct {
+	workload  string
+	pclients  string
+	startport string
+	cleanup   string
+}
+
+func parseIperfParams(r *http.Request) (iperfParams, error) {
+	p := iperfParams{
+		workload:  r.URL.Query().Get("workload"),
+		pclients:  r.URL.Query().Get("pclients"),
+		startport: r.URL.Query().Get("startport"),
+	}
+	if p.workload == "" {
+		p.workload = "ring"
+	}
+	if p.pclients == "" {
+		p.pclients = "8"
+	}
+	if p.startport == "" {
+		p.startport = "5200"
+	}
+	if r.URL.Query().Has("cleanup") {
+		p.cleanup = "--cleanup"
+	}
+	supported := false
+	for _, workload := range iperfWorkloads {
+		supported = supported || p.workload == workload
+	}
+	if !supported {
+		return p, &paramError{"workload", p.workload, "supported workloads are " + strings.Join(iperfWorkloads, ", ")}
+	}
+	pclients, err := parseInt("pclients", p.pclients, 1, 1024)
+	if err != nil {
+		return p, err
+	}
+	return p, validatePorts("startport", p.startport, pclients)
+}
+
+// writeParamError answers 400, as JSON for the JSON API and the clients accepting it, as plain text otherwise
+func writeParamError(w http.ResponseWriter, r *http.Request, err error) {
+	if strings.HasPrefix(r.URL.Path, APIPrefix) || acceptsJSON(r) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
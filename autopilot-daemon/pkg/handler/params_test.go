@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestParseStatusParams tests the parsing of the checks, iperf included, and the rejection of invalid parameters
+func TestParseStatusParams(t *testing.T) {
+	t.Setenv("PERIODIC_CHECKS", "ping,apitest")
+	tests := []struct {
+		query  string
+		checks string
+		iperf  bool
+		err    string
+	}{
+		{"", "all", false, ""},
+		{"check=iperf,apitest", "apitest", true, ""},
+		{"check=all,iperf", "all", true, ""},
+		{"check=pvc,all,iperf,apitest", "pvc,ping,apitest", true, ""},
+		{"check=all,all", "all", false, ""},
+		{"check=all,perf", "", false, "invalid check"},
+		{"check=apitest,iperf&host=worker-1,worker-2.example.com", "apitest", true, ""},
+		{"check=apitest&job=default:job-name=my-job&nodelabel=gpu%20in%20(a100,h100)&r=3&batch=2", "apitest", false, ""},
+		{"check=perf", "", false, "invalid check"},
+		{"check=apitest,", "", false, "invalid check"},
+		{"check=apitest&host=Worker-1", "", false, "invalid host"},
+		{"check=apitest&host=worker-1%3Breboot", "", false, "invalid host"},
+		{"check=apitest&pingnodes=--help", "", false, "invalid pingnodes"},
+		{"check=apitest&job=my-job", "", false, "invalid job"},
+		{"check=apitest&job=Default:app=x", "", false, "invalid job"},
+		{"check=apitest&nodelabel=a%20b", "", false, "invalid nodelabel"},
+		{"check=apitest&r=5", "", false, "invalid r"},
+		{"check=apitest&r=1%3Bls", "", false, "invalid r"},
+		{"check=apitest&batch=-1", "", false, "invalid batch"},
+	}
+	for _, test := range tests {
+		p, err := parseStatusParams(httptest.NewRequest(http.MethodGet, "/status?"+test.query, nil))
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected %q, got %v", test.query, test.err, err)
+			}
+			continue
+		}
+		if err != nil || p.checks != test.checks || p.iperf != test.iperf {
+			t.Errorf("%s: expected %s and iperf %v, got %s and iperf %v with %v", test.query, test.checks, test.iperf, p.checks, p.iperf, err)
+		}
+	}
+}
+
+// TestIperfParams tests the validation of the iperf workloads, servers and clients
+func TestIperfParams(t *testing.T) {
+	tests := []struct {
+		handler http.Handler
+		query   string
+		err     string
+	}{
+		{IperfHandler(), "workload=star", "invalid workload"},
+		{IperfHandler(), "pclients=0", "invalid pclients"},
+		{IperfHandler(), "pclients=8&startport=65530", "invalid startport"},
+		{StartIperfServersHandler(), "numservers=8&startport=http", "invalid startport"},
+		{StartIperfClientsHandler(), "dstip=10.0.0.300&dstport=5200&numclients=1", "invalid dstip"},
+		{StartIperfClientsHandler(), "dstip=fd00::1&dstport=70000&numclients=1", "invalid dstport"},
+		{StartIperfClientsHandler(), "dstip=10.0.0.1&dstport=5200", "invalid numclients"},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		test.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?"+test.query, nil))
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), test.err) {
+			t.Errorf("%s: expected %d with %q, got %d with %s", test.query, http.StatusBadRequest, test.err, w.Code, w.Body.String())
+		}
+	}
+	if err := validateCheckParams(url.Values{"host": {"all"}, "job": {"None"}, "nodelabel": {"None"}}); err != nil {
+		t.Errorf("Expected the defaults to be valid, got %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/IBM/autopilot/pkg/healthcheck"
+	"k8s.io/klog/v2"
+)
+
+// Formats of a report, see writeReport
+var reportFormats = []string{"json", "table", "csv"}
+
+// ReportHandler runs health checks on the nodes of the cluster, with the same parameters as /status, and answers
+// with an aggregated report, see healthcheck.Report. The report is a plain text table, unless the client accepts
+// JSON. The "format" parameter picks json, table or csv.
+func ReportHandler() http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		format := "table"
+		if acceptsJSON(r) {
+			format = "json"
+		}
+		writeReport(w, r, format)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// writeReport runs the checks on remote nodes, even if only the local node is selected, so that every node is
+// reached the same way. Nodes where the checks could not run are part of the report. The run fails with 500 only
+// when no node could be selected, e.g., when the nodes cannot be listed.
+func writeReport(w http.ResponseWriter, r *http.Request, format string) {
+	if value := r.URL.Query().Get("format"); value != "" {
+		format = value
+	}
+	p, err := parseStatusParams(r)
+	if err == nil && p.iperf {
+		err = errors.New("iperf is not supported by the report")
+	}
+	if err == nil && !isReportFormat(format) {
+		err = &paramError{"format", format, "supported formats are " + strings.Join(reportFormats, ", ")}
+	}
+	if err != nil {
+		writeParamError(w, r, err)
+		return
+	}
+	klog.Info("Reporting on node(s) ", p.hosts, ", node label ", p.nodelabel, ", workload ", p.jobName)
+	nodes, err := healthcheck.RunHealthRemoteNodes(r.Context(), p.hosts, p.checks, p.batch, p.jobName, p.dcgmR, p.nodelabel)
+	if err != nil {
+		klog.Error(err.Error())
+	}
+	if nodes == nil {
+		if format == "json" || strings.HasPrefix(r.URL.Path, APIPrefix) {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	report := healthcheck.NewReport(p.checks, nodes)
+	switch format {
+	case "json":
+		writeJSON(w, http.StatusOK, report)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="autopilot-report.csv"`)
+		err = report.WriteCSV(w)
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		err = report.WriteTable(w)
+	}
+	if err != nil {
+		klog.Error("Cannot write the report: ", err.Error())
+	}
+}
+
+func isReportFormat(format string) bool {
+	for _, f := range reportFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
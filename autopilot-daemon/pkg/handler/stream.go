@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IBM/autopilot/pkg/healthcheck"
+	"github.com/IBM/autopilot/pkg/utils"
+	"k8s.io/klog/v2"
+)
+
+// streamWriter sends the output of health checks to the client line by line while they run, either as chunked
+// plain text or as Server-Sent Events. Events are "queued" (the position of the request in the queue, while it waits
+// for other checks), "output" (an OutputLine), "result" (a CheckResult, once a check is done) and "done" (the end of
+// the run, with its error if any). It is safe for concurrent use.
+type streamWriter struct {
+	lock    sync.Mutex
+	w       http.ResponseWriter
+	flusher http.Flusher
+	sse     bool
+	// Whether the status of the response was sent
+	started bool
+}
+
+// newStreamWriter returns a streamWriter if the client asked for streaming, nil otherwise: "stream" or "stream=text"
+// for plain text, "stream=sse" or an Accept header with text/event-stream for Server-Sent Events.
+func newStreamWriter(w http.ResponseWriter, r *http.Request) *streamWriter {
+	s := &streamWriter{w: w, sse: acceptsEventStream(r)}
+	if !s.sse {
+		if !r.URL.Query().Has("stream") {
+			return nil
+		}
+		s.sse = r.URL.Query().Get("stream") == "sse"
+	}
+	s.flusher, _ = w.(http.Flusher)
+	if s.sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		// Keeps browsers from buffering the output to guess its type
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+	}
+	// The status is sent with the first line, so that errors like a busy node can still be answered with their own
+	return s
+}
+
+func acceptsEventStream(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediatype, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err == nil && mediatype == "text/event-stream" {
+			return true
+		}
+	}
+	return false
+}
+
+// context returns a context under which the output and the results of the checks are streamed
+func (s *streamWriter) context(ctx context.Context) context.Context {
+	ctx = healthcheck.WithOutputHook(ctx, s.output)
+	return healthcheck.WithResultHook(ctx, s.result)
+}
+
+// Write sends messages of the daemon, e.g., the description of a check. Events carry them as output of the local node.
+func (s *streamWriter) Write(p []byte) (int, error) {
+	if !s.sse {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		defer s.flush()
+		s.started = true
+		return s.w.Write(p)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(string(p), "\n"), "\n") {
+		s.output(healthcheck.OutputLine{Node: utils.NodeName, Stream: healthcheck.StreamStdout, Line: line, Time: time.Now()})
+	}
+	return len(p), nil
+}
+
+func (s *streamWriter) output(line healthcheck.OutputLine) {
+	if s.sse {
+		s.event("output", line)
+		return
+	}
+	text := line.Line + "\n"
+	if line.Node != "" && line.Node != utils.NodeName {
+		text = "[" + line.Node + "] " + text
+	}
+	s.write(text)
+}
+
+// queued sends the position of the request in the queue
+func (s *streamWriter) queued(position int, holder utils.LockHolder) {
+	if s.sse {
+		s.event("queued", struct {
+			Position int              `json:"position"`
+			Running  utils.LockHolder `json:"running"`
+		}{position, holder})
+		return
+	}
+	s.write(queuedMessage(position, holder))
+}
+
+// progress returns the callback reporting the position of the request in the queue, nil if s is nil
+func (s *streamWriter) progress() func(int, utils.LockHolder) {
+	if s == nil {
+		return nil
+	}
+	return s.queued
+}
+
+func (s *streamWriter) result(result *healthcheck.CheckResult) {
+	if s.sse {
+		s.event("result", result)
+		return
+	}
+	s.write(fmt.Sprintf("Health check %s completed with status %s in %.3fs\n", result.Check, result.Status, result.Duration.Seconds()))
+}
+
+// done ends the stream
+func (s *streamWriter) done(err error) {
+	if s.sse {
+		done := struct {
+			Node  string `json:"node"`
+			Error string `json:"error,omitempty"`
+		}{Node: utils.NodeName}
+		if err != nil {
+			done.Error = err.Error()
+		}
+		s.event("done", done)
+		return
+	}
+	if err != nil {
+		s.write("Error: " + err.Error() + "\n")
+	}
+}
+
+func (s *streamWriter) event(name string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		klog.Error(err.Error())
+		return
+	}
+	s.write("event: " + name + "\ndata: " + string(data) + "\n\n")
+}
+
+func (s *streamWriter) write(text string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.started = true
+	if _, err := s.w.Write([]byte(text)); err != nil {
+		return
+	}
+	s.flush()
+}
+
+// flush sends the buffered output to the client. The caller must hold the lock.
+func (s *streamWriter) flush() {
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+}
+
+// start sends the status of the response, so that the client knows the run started before its first line
+func (s *streamWriter) start() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.started {
+		return
+	}
+	s.started = true
+	s.w.WriteHeader(http.StatusOK)
+	s.flush()
+}
+
+// streamCheck runs a single check on the local node, streaming its output. The caller must hold the health check lock.
+func streamCheck(s *streamWriter, r *http.Request, c healthcheck.Checker) {
+	s.start()
+	_, err := healthcheck.RunCheck(s.context(r.Context()), c, checkParams(r))
+	s.done(err)
+}
+
+// streamStatus runs checks on the local node or on remote nodes, as /status does, streaming their output.
+// The caller must hold the health check lock for local runs.
+func streamStatus(s *streamWriter, r *http.Request, p statusParams) {
+	s.start()
+	ctx := s.context(r.Context())
+	if p.hosts != utils.NodeName {
+		klog.Info("Asking to run on remote node(s) ", p.hosts, " or with node label ", p.nodelabel)
+		nodes, err := healthcheck.RunHealthRemoteNodes(ctx, p.hosts, p.checks, p.batch, p.jobName, p.dcgmR, p.nodelabel)
+		if nodes != nil {
+			s.Write(healthcheck.FormatNodeSummary(nodes))
+		}
+		s.done(err)
+		return
+	}
+	_, err := healthcheck.RunHealthLocalNode(ctx, p.checks, p.dcgmR, p.jobName, p.nodelabel, r)
+	klog.Info("Errors after running local, on demand health checks: ", healthcheck.GetNodeStatus())
+	utils.PatchNode(healthcheck.NodeHealthLabel(), utils.NodeName, false)
+	s.done(err)
+}
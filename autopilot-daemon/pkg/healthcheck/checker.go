@@ -0,0 +1,163 @@
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IBM/autopilot/pkg/utils"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+)
+
+// Checker is implemented by every health check that can run on the local node.
+// A check becomes available to the periodic runner, to /status and to its own
+// HTTP endpoint (named after the check) once it is passed to Register.
+type Checker interface {
+	// Name of the check, as used in PERIODIC_CHECKS, in the "check" query parameter and in the endpoint path
+	Name() HealthCheck
+	// Run the check with the parameters of the request (e.g., "r" for dcgm, "job" and "nodelabel" for ping).
+	// The check must stop when ctx is done.
+	Run(ctx context.Context, params url.Values) (*CheckResult, error)
+	Metadata() CheckMetadata
+}
+
+type CheckMetadata struct {
+	// Short description, written back to the caller of the check endpoint
+	Description string
+	// Whether the check runs by default when PERIODIC_CHECKS is not set
+	Periodic bool
+	// Value of the "health" label of the health checks gauge. Defaults to the check name
+	MetricName string
+	// Default deadline of a run, overridden by CHECK_TIMEOUTS. Zero means no deadline
+	Timeout time.Duration
+	// Whether the check can run alongside other checks. Checks using the GPUs exclusively must run one at a time
+	Concurrent bool
+	// Failures of the check are reported, but do not count against the node health
+	Informational bool
+}
+
+var (
+	registry     = make(map[HealthCheck]Checker)
+	registryLock sync.RWMutex
+)
+
+// Names of the endpoints of the daemon, and keywords of the "check" parameter, that checks loaded at startup cannot take
+var reservedCheckNames = map[string]bool{
+	"all": true, "api": true, "history": true, "invasive": true, "iperf": true, "iperfclients": true, "iperfservers": true,
+	"iperfstopservers": true, "metrics": true, "readinessprobe": true, "report": true, "state": true, "status": true,
+}
+
+// validateCheckName checks the name of a check loaded at startup: an RFC 1123 label, usable as an endpoint path and
+// in a comma separated list of checks, that is not reserved
+func validateCheckName(name string) error {
+	if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+		return fmt.Errorf("invalid name %q: %s", name, strings.Join(errs, ", "))
+	}
+	if reservedCheckNames[name] {
+		return fmt.Errorf("invalid name %q: reserved", name)
+	}
+	return nil
+}
+
+// Register makes a health check available by name. Built-in checks register themselves in init().
+// Registering two checks with the same name is a programming error and panics.
+func Register(c Checker) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if _, exists := registry[c.Name()]; exists {
+		panic("health check already registered: " + string(c.Name()))
+	}
+	klog.V(4).Info("Registered health check ", c.Name())
+	registry[c.Name()] = c
+}
+
+func GetChecker(name HealthCheck) (Checker, bool) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	c, found := registry[name]
+	return c, found
+}
+
+// RegisteredChecks returns all the registered checks, sorted by name
+func RegisteredChecks() []Checker {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	checks := make([]Checker, 0, len(registry))
+	for _, c := range registry {
+		checks = append(checks, c)
+	}
+	sort.Slice(checks, func(i, j int) bool {
+		return checks[i].Name() < checks[j].Name()
+	})
+	return checks
+}
+
+// RunCheck runs a check on the local node, then records its result in the node status and in the metrics,
+// subject to the fail-after and recover-after thresholds of the check.
+// The run is cancelled when ctx is done or when the check timeout expires, whichever comes first.
+// The returned result is never nil.
+func RunCheck(ctx context.Context, c Checker, params url.Values) (*CheckResult, error) {
+	timeout := GetCheckTimeout(c)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	klog.Info("Running health check: ", c.Name(), " with timeout ", timeout)
+	result, err := c.Run(withCheckName(ctx, c.Name()), params)
+	if result == nil {
+		result = newCheckResult(c.Name()).finish(nil)
+		result.Status = StatusError
+	}
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		klog.Info("Health check ", c.Name(), " timed out after ", timeout)
+		result.Status = StatusTimeout
+		result.Observations = nil
+		err = fmt.Errorf("health check %s timed out after %s", c.Name(), timeout)
+		utils.HchecksTimeouts.WithLabelValues(string(c.Name()), utils.NodeName).Inc()
+	case context.Canceled:
+		klog.Info("Health check ", c.Name(), " cancelled")
+		result.Status = StatusAbort
+		result.Observations = nil
+		err = fmt.Errorf("health check %s cancelled", c.Name())
+	}
+	applyThresholds(result)
+	if err != nil {
+		klog.Error("Health check ", c.Name(), " exited with errors: ", err.Error())
+		if result.Status == StatusPass {
+			result.Status = StatusError
+		}
+	}
+	// The gauge follows the status of the check: a run that disagrees with it is not exported until the status flips
+	if State.Record(result, err) {
+		updateMetrics(c, result)
+	}
+	History.Add(result)
+	saveState()
+	updateNodeHealth()
+	if hook, found := ctx.Value(resultHookKey{}).(func(*CheckResult)); found {
+		hook(result)
+	}
+	klog.Info("Health check ", c.Name(), " completed with status ", result.Status, " in ", result.Duration.Seconds(), "s")
+	return result, err
+}
+
+type resultHookKey struct{}
+
+// WithResultHook returns a context under which RunCheck passes every result to hook, e.g., to track the progress of a run
+func WithResultHook(ctx context.Context, hook func(*CheckResult)) context.Context {
+	return context.WithValue(ctx, resultHookKey{}, hook)
+}
+
+func getParam(params url.Values, key string, def string) string {
+	if v := params.Get(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,137 @@
+package healthcheck
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Built-in health checks. Each type wraps the corresponding Run* function.
+
+type pcieBWCheck struct{}
+
+func (pcieBWCheck) Name() HealthCheck { return PCIeBW }
+
+func (pcieBWCheck) Run(ctx context.Context, params url.Values) (*CheckResult, error) {
+	return RunPCIeBW(ctx)
+}
+
+func (pcieBWCheck) Metadata() CheckMetadata {
+	return CheckMetadata{
+		Description: "Requesting pcie test with bw: " + strconv.FormatFloat(PCIeBWThreshold(), 'f', -1, 64),
+		Periodic:    true,
+		Timeout:     10 * time.Minute,
+	}
+}
+
+type remappedRowsCheck struct{}
+
+func (remappedRowsCheck) Name() HealthCheck { return RowRemap }
+
+func (remappedRowsCheck) Run(ctx context.Context, params url.Values) (*CheckResult, error) {
+	return RunRemappedRows(ctx)
+}
+
+func (remappedRowsCheck) Metadata() CheckMetadata {
+	return CheckMetadata{
+		Description: "Requesting Remapped Rows check on all GPUs",
+		Periodic:    true,
+		Timeout:     5 * time.Minute,
+		Concurrent:  true,
+	}
+}
+
+type dcgmCheck struct{}
+
+func (dcgmCheck) Name() HealthCheck { return DCGM }
+
+// Accepts "r", the dcgmi diag level. Defaults to 1
+func (dcgmCheck) Run(ctx context.Context, params url.Values) (*CheckResult, error) {
+	return RunDCGM(ctx, getParam(params, "r", "1"))
+}
+
+func (dcgmCheck) Metadata() CheckMetadata {
+	return CheckMetadata{
+		Description: "DCGM test",
+		Periodic:    true,
+		Timeout:     time.Hour,
+	}
+}
+
+type pingCheck struct{}
+
+func (pingCheck) Name() HealthCheck { return Ping }
+
+// Accepts "pingnodes" (or "host", as used by the /ping endpoint), "job" and "nodelabel"
+func (pingCheck) Run(ctx context.Context, params url.Values) (*CheckResult, error) {
+	nodes := getParam(params, "pingnodes", getParam(params, "host", "all"))
+	return RunPing(ctx, nodes, getParam(params, "job", "None"), getParam(params, "nodelabel", "None"))
+}
+
+func (pingCheck) Metadata() CheckMetadata {
+	return CheckMetadata{
+		Description: "Ping test",
+		Periodic:    true,
+		Timeout:     10 * time.Minute,
+		Concurrent:  true,
+	}
+}
+
+type gpuPowerCheck struct{}
+
+func (gpuPowerCheck) Name() HealthCheck { return GPUPower }
+
+func (gpuPowerCheck) Run(ctx context.Context, params url.Values) (*CheckResult, error) {
+	return RunGPUPower(ctx)
+}
+
+func (gpuPowerCheck) Metadata() CheckMetadata {
+	return CheckMetadata{
+		Description: "GPU Power Measurement test",
+		Periodic:    true,
+		MetricName:  "power-slowdown",
+		Timeout:     5 * time.Minute,
+	}
+}
+
+type gpuMemCheck struct{}
+
+func (gpuMemCheck) Name() HealthCheck { return GPUMem }
+
+func (gpuMemCheck) Run(ctx context.Context, params url.Values) (*CheckResult, error) {
+	return RunGPUMem(ctx)
+}
+
+func (gpuMemCheck) Metadata() CheckMetadata {
+	return CheckMetadata{
+		Description: "GPU Memory DGEMM+DAXPY test",
+		Timeout:     15 * time.Minute,
+	}
+}
+
+type pvcCheck struct{}
+
+func (pvcCheck) Name() HealthCheck { return PVC }
+
+func (pvcCheck) Run(ctx context.Context, params url.Values) (*CheckResult, error) {
+	return RunCreateDeletePVC(ctx)
+}
+
+func (pvcCheck) Metadata() CheckMetadata {
+	return CheckMetadata{
+		Description: "PVC create-delete test",
+		Timeout:     5 * time.Minute,
+		Concurrent:  true,
+	}
+}
+
+func init() {
+	Register(pcieBWCheck{})
+	Register(remappedRowsCheck{})
+	Register(dcgmCheck{})
+	Register(pingCheck{})
+	Register(gpuPowerCheck{})
+	Register(gpuMemCheck{})
+	Register(pvcCheck{})
+}
@@ -0,0 +1,259 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/autopilot/pkg/utils"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// CustomCheckSpec declares a health check running an arbitrary command, usually from a ConfigMap
+type CustomCheckSpec struct {
+	// Name of the check. Defaults to the name of the file holding the spec, without extension
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Command     string   `json:"command"`
+	Args        []string `json:"args"`
+	// Deadline of a run, in interval format (e.g., 30s, 5m). Defaults to 10m
+	Timeout string `json:"timeout"`
+	// Value of the "health" label of the health checks gauge. Defaults to the check name
+	MetricName string `json:"metricName"`
+	// Whether a failure marks the node with gpuhealth=WARN. Defaults to true
+	AffectsHealth *bool `json:"affectsHealth"`
+	// Whether the check runs by default when PERIODIC_CHECKS is not set
+	Periodic bool `json:"periodic"`
+	// Whether the check can run alongside other checks
+	Concurrent bool             `json:"concurrent"`
+	Rules      CustomCheckRules `json:"rules"`
+}
+
+// CustomCheckRules decide the status of a custom check. The check fails if any rule fails.
+type CustomCheckRules struct {
+	// Exit codes of a successful run. Defaults to 0
+	ExitCodes []int `json:"exitCodes"`
+	// The check fails if the output matches
+	FailRegex string `json:"failRegex"`
+	// The check fails if the output does not match
+	PassRegex string `json:"passRegex"`
+	// Bounds of the values in the last line of the output
+	Thresholds []ColumnThreshold `json:"thresholds"`
+}
+
+// ColumnThreshold bounds the values of a column of the last line of the output.
+// Each value is exported through the health checks gauge, with the column index as device id.
+type ColumnThreshold struct {
+	// Index of the column, starting from 0. All the columns if omitted
+	Column *int     `json:"column"`
+	Min    *float64 `json:"min"`
+	Max    *float64 `json:"max"`
+	Unit   string   `json:"unit"`
+}
+
+// customCheck runs the command of a CustomCheckSpec and applies its rules.
+// Commands speaking the result protocol are parsed as such, and their rules are ignored.
+type customCheck struct {
+	spec      CustomCheckSpec
+	timeout   time.Duration
+	failRegex *regexp.Regexp
+	passRegex *regexp.Regexp
+}
+
+func (c customCheck) Name() HealthCheck { return HealthCheck(c.spec.Name) }
+
+func (c customCheck) Metadata() CheckMetadata {
+	description := c.spec.Description
+	if description == "" {
+		description = "Custom health check " + c.spec.Name
+	}
+	return CheckMetadata{
+		Description:   description,
+		Periodic:      c.spec.Periodic,
+		MetricName:    c.spec.MetricName,
+		Timeout:       c.timeout,
+		Concurrent:    c.spec.Concurrent,
+		Informational: c.spec.AffectsHealth != nil && !*c.spec.AffectsHealth,
+	}
+}
+
+func (c customCheck) Run(ctx context.Context, params url.Values) (*CheckResult, error) {
+	result := newCheckResult(c.Name())
+	stdout, stderr, err := runScriptWithEnv(ctx, paramsEnv(params), c.spec.Command, c.spec.Args...)
+	exitCode := 0
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && ctx.Err() == nil {
+		exitCode = exitErr.ExitCode()
+		err = nil
+	}
+	if err != nil {
+		out := append(stderr, stdout...)
+		klog.Info("Out:", string(out))
+		return result.finish(out), err
+	}
+	return parseOutput(result, stdout, stderr, func(result *CheckResult, out []byte) (*CheckResult, error) {
+		return c.evaluate(result, out, exitCode)
+	})
+}
+
+func (c customCheck) evaluate(result *CheckResult, out []byte, exitCode int) (*CheckResult, error) {
+	defer result.finish(out)
+	rules := c.spec.Rules
+	exitCodes := rules.ExitCodes
+	if len(exitCodes) == 0 {
+		exitCodes = []int{0}
+	}
+	failed := true
+	for _, code := range exitCodes {
+		failed = failed && code != exitCode
+	}
+	if failed {
+		klog.Info("Health check ", c.spec.Name, " exited with code ", exitCode)
+	}
+	if c.failRegex != nil && c.failRegex.Match(out) {
+		klog.Info("Health check ", c.spec.Name, " output matches ", rules.FailRegex)
+		failed = true
+	}
+	if c.passRegex != nil && !c.passRegex.Match(out) {
+		klog.Info("Health check ", c.spec.Name, " output does not match ", rules.PassRegex)
+		failed = true
+	}
+	if len(rules.Thresholds) == 0 {
+		if failed {
+			result.Status = StatusFail
+			result.addObservation("", 1, "")
+		} else {
+			result.addObservation("", 0, "")
+		}
+		return result, nil
+	}
+
+	values, err := parseLastLine(out)
+	if err != nil {
+		return result, err
+	}
+	for col, value := range values {
+		for _, t := range rules.Thresholds {
+			if t.Column != nil && *t.Column != col {
+				continue
+			}
+			o := Observation{
+				DeviceID:     strconv.Itoa(col),
+				Value:        value,
+				Unit:         t.Unit,
+				Threshold:    t.Min,
+				MaxThreshold: t.Max,
+			}
+			if o.outOfBounds() {
+				klog.Info("Health check ", c.spec.Name, " value ", value, " of column ", col, " out of bounds")
+				failed = true
+			}
+			result.Observations = append(result.Observations, o)
+			break
+		}
+	}
+	if failed {
+		result.Status = StatusFail
+	}
+	return result, nil
+}
+
+// paramsEnv passes the request parameters as AUTOPILOT_PARAM_<NAME> environment variables
+func paramsEnv(params url.Values) []string {
+	env := []string{}
+	for k := range params {
+		env = append(env, "AUTOPILOT_PARAM_"+strings.ToUpper(k)+"="+params.Get(k))
+	}
+	sort.Strings(env)
+	return env
+}
+
+// newCustomCheck validates a spec
+func newCustomCheck(spec CustomCheckSpec) (customCheck, error) {
+	c := customCheck{spec: spec, timeout: 10 * time.Minute}
+	if spec.Name == "" {
+		return c, fmt.Errorf("missing required field \"name\"")
+	}
+	if err := validateCheckName(spec.Name); err != nil {
+		return c, fmt.Errorf("invalid field \"name\": %w", err)
+	}
+	if spec.Command == "" {
+		return c, fmt.Errorf("missing required field \"command\"")
+	}
+	var err error
+	if spec.Timeout != "" {
+		if c.timeout, err = utils.ParseInterval(spec.Timeout); err != nil {
+			return c, fmt.Errorf("invalid field \"timeout\": %w", err)
+		}
+	}
+	if spec.Rules.FailRegex != "" {
+		if c.failRegex, err = regexp.Compile(spec.Rules.FailRegex); err != nil {
+			return c, fmt.Errorf("invalid field \"rules.failRegex\": %w", err)
+		}
+	}
+	if spec.Rules.PassRegex != "" {
+		if c.passRegex, err = regexp.Compile(spec.Rules.PassRegex); err != nil {
+			return c, fmt.Errorf("invalid field \"rules.passRegex\": %w", err)
+		}
+	}
+	for i, t := range spec.Rules.Thresholds {
+		if t.Min == nil && t.Max == nil {
+			return c, fmt.Errorf("missing required field \"rules.thresholds[%d].min\" or \"rules.thresholds[%d].max\"", i, i)
+		}
+	}
+	return c, nil
+}
+
+// LoadCustomChecks registers the custom checks declared in the YAML or JSON files of dir,
+// one check per file, as mounted from the custom checks ConfigMap.
+// Names colliding with an already registered check are skipped. Invalid specs are rejected: the valid ones are
+// still registered, and the returned error names the file and the field of each invalid spec.
+func LoadCustomChecks(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		klog.V(2).Info("No custom health checks loaded from ", dir, ": ", err.Error())
+		return nil
+	}
+	errs := []error{}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml" && ext != ".json") {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cannot read custom health check %s: %w", entry.Name(), err))
+			continue
+		}
+		spec := CustomCheckSpec{}
+		if err := yaml.UnmarshalStrict(content, &spec); err != nil {
+			errs = append(errs, fmt.Errorf("invalid custom health check %s: %w", entry.Name(), err))
+			continue
+		}
+		if spec.Name == "" {
+			spec.Name = strings.TrimSuffix(entry.Name(), ext)
+		}
+		c, err := newCustomCheck(spec)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid custom health check %s: %w", entry.Name(), err))
+			continue
+		}
+		if _, found := GetChecker(c.Name()); found {
+			klog.Info("Health check ", c.Name(), " already registered, skipping ", entry.Name())
+			continue
+		}
+		klog.Info("Loaded custom health check ", c.Name(), " from ", entry.Name())
+		Register(c)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,114 @@
+package healthcheck
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCustomCheck tests the exit code, regex and threshold rules of custom checks
+func TestCustomCheck(t *testing.T) {
+	one, two := 1, 2
+	low, high := 10.0, 100.0
+	tests := []struct {
+		name     string
+		script   string
+		rules    CustomCheckRules
+		expected CheckStatus
+		values   []float64
+	}{
+		{"exit code", "exit 0", CustomCheckRules{}, StatusPass, []float64{0}},
+		{"bad exit code", "exit 3", CustomCheckRules{}, StatusFail, []float64{1}},
+		{"allowed exit code", "exit 3", CustomCheckRules{ExitCodes: []int{0, 3}}, StatusPass, []float64{0}},
+		{"fail regex", "echo 'State: Down'", CustomCheckRules{FailRegex: "State: (Down|Init)"}, StatusFail, []float64{1}},
+		{"pass regex", "echo 'Driver 535.104'", CustomCheckRules{PassRegex: `Driver 5\d\d\.`}, StatusPass, []float64{0}},
+		{"missing pass regex", "echo 'Driver 470.57'", CustomCheckRules{PassRegex: `Driver 5\d\d\.`}, StatusFail, []float64{1}},
+		{"thresholds", "echo ports; echo 200 50 400", CustomCheckRules{Thresholds: []ColumnThreshold{{Column: &one, Min: &low}, {Min: &high}}}, StatusPass, []float64{200, 50, 400}},
+		{"column below min", "echo 200 5 400", CustomCheckRules{Thresholds: []ColumnThreshold{{Column: &one, Min: &low}}}, StatusFail, []float64{5}},
+		{"column above max", "echo 200 5 400", CustomCheckRules{Thresholds: []ColumnThreshold{{Column: &two, Max: &high}}}, StatusFail, []float64{400}},
+	}
+	for _, test := range tests {
+		c, err := newCustomCheck(CustomCheckSpec{Name: "custom", Command: "sh", Args: []string{"-c", test.script}, Rules: test.rules})
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", test.name, err)
+		}
+		result, err := c.Run(context.Background(), url.Values{})
+		if err != nil {
+			t.Errorf("%s: expected no error, got %v", test.name, err)
+		}
+		if result.Status != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, result.Status)
+		}
+		if len(result.Observations) != len(test.values) {
+			t.Errorf("%s: expected %d observations, got %+v", test.name, len(test.values), result.Observations)
+			continue
+		}
+		for i, v := range test.values {
+			if result.Observations[i].Value != v {
+				t.Errorf("%s: expected value %v, got %v", test.name, v, result.Observations[i].Value)
+			}
+		}
+	}
+
+	invalid := map[string]CustomCheckSpec{
+		`"command"`:                 {Name: "nocommand"},
+		`"name"`:                    {Name: "bad/name", Command: "true"},
+		`"Upper"`:                   {Name: "Upper", Command: "true"},
+		`"status": reserved`:        {Name: "status", Command: "true"},
+		`"all": reserved`:           {Name: "all", Command: "true"},
+		`"iperf": reserved`:         {Name: "iperf", Command: "true"},
+		`"rules.failRegex"`:         {Name: "badregex", Command: "true", Rules: CustomCheckRules{FailRegex: "("}},
+		`"timeout"`:                 {Name: "badtimeout", Command: "true", Timeout: "soon"},
+		`"rules.thresholds[0].min"`: {Name: "nobounds", Command: "true", Rules: CustomCheckRules{Thresholds: []ColumnThreshold{{}}}},
+	}
+	for field, spec := range invalid {
+		if _, err := newCustomCheck(spec); err == nil || !strings.Contains(err.Error(), field) {
+			t.Errorf("Expected an error naming %s for %+v, got %v", field, spec, err)
+		}
+	}
+}
+
+// TestLoadCustomChecks tests that specs are loaded from files, and that informational checks do not affect the node health
+func TestLoadCustomChecks(t *testing.T) {
+	dir := t.TempDir()
+	spec := `command: sh
+args: ["-c", "echo 'Driver 470.57'"]
+timeout: 30s
+affectsHealth: false
+rules:
+  passRegex: 'Driver 5\d\d\.'
+`
+	if err := os.WriteFile(filepath.Join(dir, "custom-driver.yaml"), []byte(spec), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "custom-invalid.yaml"), []byte("command: sh\nunknown: 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "custom-nocommand.yaml"), []byte("args: [\"-c\", \"true\"]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := LoadCustomChecks(dir)
+	if err == nil || !strings.Contains(err.Error(), "custom-invalid.yaml") || !strings.Contains(err.Error(), `custom-nocommand.yaml: missing required field "command"`) {
+		t.Errorf("Expected the invalid specs to be rejected, got %v", err)
+	}
+	for _, name := range []HealthCheck{"custom-invalid", "custom-nocommand"} {
+		if _, found := GetChecker(name); found {
+			t.Errorf("Expected %s not to be registered", name)
+		}
+	}
+	c, found := GetChecker("custom-driver")
+	if !found {
+		t.Fatalf("Expected custom-driver to be registered")
+	}
+	if !c.Metadata().Informational || GetCheckTimeout(c).Seconds() != 30 {
+		t.Errorf("Unexpected metadata %+v", c.Metadata())
+	}
+	State = NewStateStore()
+	result, _ := RunCheck(context.Background(), c, url.Values{})
+	if result.Status != StatusFail || GetNodeStatus() {
+		t.Errorf("Expected %v without affecting the node health, got %v and %v", StatusFail, result.Status, GetNodeStatus())
+	}
+}
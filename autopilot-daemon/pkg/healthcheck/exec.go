@@ -0,0 +1,61 @@
+package healthcheck
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Executor runs the external commands of the health checks. Tests replace it to replay recorded outputs.
+type Executor interface {
+	// Run runs a command with extra environment variables, in the "key=value" form, until it exits or ctx is done.
+	// Standard output and standard error are returned separately, and streamed to the output hook of ctx, if any.
+	Run(ctx context.Context, env []string, name string, args ...string) ([]byte, []byte, error)
+}
+
+// The executor used by all the checks
+var CommandExecutor Executor = processExecutor{}
+
+// runScript runs a check script, asking it to report with the result protocol.
+// Standard output and standard error are returned separately, as only the former carries protocol records.
+// The script and all its children are killed when ctx is done.
+func runScript(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+	return runScriptWithEnv(ctx, nil, name, args...)
+}
+
+// runScriptWithEnv is runScript with extra environment variables, in the "key=value" form
+func runScriptWithEnv(ctx context.Context, env []string, name string, args ...string) ([]byte, []byte, error) {
+	env = append([]string{ProtocolEnv + "=" + strconv.Itoa(ProtocolVersion)}, env...)
+	return CommandExecutor.Run(ctx, env, name, args...)
+}
+
+// processExecutor runs commands as child processes of the daemon
+type processExecutor struct{}
+
+func (processExecutor) Run(ctx context.Context, env []string, name string, args ...string) ([]byte, []byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if stdoutW, stderrW := outputWriters(ctx); stdoutW != nil {
+		cmd.Stdout = io.MultiWriter(&stdout, stdoutW)
+		cmd.Stderr = io.MultiWriter(&stderr, stderrW)
+		defer stdoutW.Flush()
+		defer stderrW.Flush()
+	}
+	// The script runs in its own process group, so that the whole group can be killed on timeout
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	// Do not wait forever on orphans still holding the output pipes
+	cmd.WaitDelay = 5 * time.Second
+	err := cmd.Run()
+	return stdout.Bytes(), stderr.Bytes(), err
+}
@@ -0,0 +1,95 @@
+package healthcheck
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestRunScriptTimeout tests that a script and its children are killed when the context expires
+func TestRunScriptTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, _, err := runScript(ctx, "sh", "-c", "sleep 30 & sleep 30; echo done")
+	if err == nil {
+		t.Errorf("Expected error for a killed script, got nil")
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Expected the script to be killed on timeout, returned after %v", elapsed)
+	}
+	if ctx.Err() != context.DeadlineExceeded {
+		t.Errorf("Expected deadline exceeded, got %v", ctx.Err())
+	}
+}
+
+// blockingExecutor prints some output, then runs until ctx is done
+type blockingExecutor struct{}
+
+func (blockingExecutor) Run(ctx context.Context, env []string, name string, args ...string) ([]byte, []byte, error) {
+	<-ctx.Done()
+	return []byte("started\n"), nil, ctx.Err()
+}
+
+// TestIperfTimeout tests that the iperf scripts stop when the iperf timeout expires, and return their output
+func TestIperfTimeout(t *testing.T) {
+	defer func(e Executor, timeouts map[HealthCheck]time.Duration) { CommandExecutor, checkTimeouts = e, timeouts }(CommandExecutor, checkTimeouts)
+	CommandExecutor = blockingExecutor{}
+	checkTimeouts = map[HealthCheck]time.Duration{Iperf: 50 * time.Millisecond}
+	out, err := StartIperfClients(context.Background(), "10.0.0.1", "5200", "1")
+	if err == nil || !strings.Contains(err.Error(), "TIMEOUT") {
+		t.Errorf("Expected a timeout, got %v", err)
+	}
+	if out == nil || string(*out) != "started\n" {
+		t.Errorf("Expected the output of the script, got %v", out)
+	}
+}
+
+// TestParseCheckDurations tests that check names are trimmed, and that unknown checks and invalid durations are rejected
+func TestParseCheckDurations(t *testing.T) {
+	durations, err := parseCheckDurations("dcgm =2h, ping= 5m,iperf=10m")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := map[HealthCheck]time.Duration{DCGM: 2 * time.Hour, Ping: 5 * time.Minute, Iperf: 10 * time.Minute}
+	if !reflect.DeepEqual(durations, expected) {
+		t.Errorf("Expected %v, got %v", expected, durations)
+	}
+	for _, list := range []string{"nosuchcheck=1m", "dcgm=soon", "dcgm"} {
+		if _, err := parseCheckDurations(list); err == nil {
+			t.Errorf("%s: expected error, got nil", list)
+		}
+	}
+}
+
+// TestRunScriptOutputHook tests that the output of a script is streamed line by line, and still returned in full
+func TestRunScriptOutputHook(t *testing.T) {
+	var lock sync.Mutex
+	lines := []OutputLine{}
+	ctx := WithOutputHook(withCheckName(context.Background(), "streamtest"), func(line OutputLine) {
+		lock.Lock()
+		defer lock.Unlock()
+		lines = append(lines, line)
+	})
+	stdout, _, err := runScript(ctx, "sh", "-c", "echo one; echo two >&2; printf three")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if string(stdout) != "one\nthree" {
+		t.Errorf("Expected the full output to be returned, got %q", stdout)
+	}
+	streamed := map[string]string{}
+	for _, line := range lines {
+		if line.Check != "streamtest" {
+			t.Errorf("Expected line %q to be tagged with the check, got %q", line.Line, line.Check)
+		}
+		streamed[line.Line] = line.Stream
+	}
+	expected := map[string]string{"one": StreamStdout, "two": StreamStderr, "three": StreamStdout}
+	if !reflect.DeepEqual(streamed, expected) {
+		t.Errorf("Expected lines %v, got %v", expected, streamed)
+	}
+}
@@ -12,53 +12,51 @@ import (
 	"k8s.io/klog/v2"
 )
 
-func ListPVC() (string, error) {
-	pvc, err := utils.GetClientsetInstance().Cset.CoreV1().PersistentVolumeClaims(utils.Namespace).Get(context.Background(), utils.PodName, metav1.GetOptions{})
+func ListPVC(ctx context.Context) (CheckStatus, string, error) {
+	pvc, err := utils.GetClientsetInstance().Cset.CoreV1().PersistentVolumeClaims(utils.Namespace).Get(ctx, utils.PodName, metav1.GetOptions{})
 	if err != nil {
 		klog.Error("Error in creating the lister", err.Error())
-		return "ABORT", err
+		return StatusAbort, "ABORT", err
 	}
 	switch pvc.Status.Phase {
 	case "Bound":
 		{
 			klog.Info("[PVC Create-Delete] PVC Bound: SUCCESS")
-			klog.Info("Observation: ", utils.NodeName, " 0")
-			utils.HchecksGauge.WithLabelValues("pvc", utils.NodeName, utils.CPUModel, utils.GPUModel, "").Set(0)
 		}
 	case "Pending":
 		{
 			waitonpvc := time.NewTicker(time.Minute)
 			defer waitonpvc.Stop()
-			<-waitonpvc.C
-			pvc, err := utils.GetClientsetInstance().Cset.CoreV1().PersistentVolumeClaims(utils.Namespace).Get(context.Background(), utils.PodName, metav1.GetOptions{})
+			select {
+			case <-waitonpvc.C:
+			case <-ctx.Done():
+				deletePVC(utils.PodName)
+				return StatusAbort, "[PVC Create-Delete] Interrupted. ABORT", ctx.Err()
+			}
+			pvc, err := utils.GetClientsetInstance().Cset.CoreV1().PersistentVolumeClaims(utils.Namespace).Get(ctx, utils.PodName, metav1.GetOptions{})
 			if err != nil {
 				klog.Error("[PVC Create-Delete] Error in creating the lister: ", err.Error())
-				return "[PVC Create-Delete] PVC not found. ABORT ", err
+				return StatusAbort, "[PVC Create-Delete] PVC not found. ABORT ", err
 			}
 			phase := pvc.Status.Phase
 			if pvc.Status.Phase == "Pending" {
 				klog.Info("[PVC Create-Delete] Timer is up with PVC Pending. Force delete. FAIL")
-				klog.Info("Observation: ", utils.NodeName, " 1")
-				utils.HchecksGauge.WithLabelValues("pvc", utils.NodeName, utils.CPUModel, utils.GPUModel, "").Set(1)
 				err := deletePVC(utils.PodName)
 				if err != nil {
-					return "[PVC Create-Delete] Error in deleting the PVC. ABORT ", err
+					return StatusAbort, "[PVC Create-Delete] Error in deleting the PVC. ABORT ", err
 				}
-				HealthCheckStatus[PVC] = true
-				return "[PVC Create-Delete] FAIL", nil
+				return StatusFail, "[PVC Create-Delete] FAIL", nil
 			}
 			if phase == "Bound" {
 				klog.Info("[PVC Create-Delete] PVC Bound: SUCCESS")
-				klog.Info("Observation: ", utils.NodeName, " 0")
-				utils.HchecksGauge.WithLabelValues("pvc", utils.NodeName, utils.CPUModel, utils.GPUModel, "").Set(0)
 			}
 		}
 	}
 	err = deletePVC(utils.PodName)
 	if err != nil {
-		return "Error in deleting the PVC. ABORT ", err
+		return StatusAbort, "Error in deleting the PVC. ABORT ", err
 	}
-	return "[PVC Create-Delete] PVC SUCCESS", nil
+	return StatusPass, "[PVC Create-Delete] PVC SUCCESS", nil
 }
 
 func deletePVC(pvc string) error {
@@ -70,7 +68,7 @@ func deletePVC(pvc string) error {
 	return err
 }
 
-func createPVC() error {
+func createPVC(ctx context.Context) error {
 	cset := utils.GetClientsetInstance()
 	storageclass := os.Getenv("PVC_TEST_STORAGE_CLASS")
 	pvcTemplate := corev1.PersistentVolumeClaim{
@@ -90,16 +88,20 @@ func createPVC() error {
 		},
 	}
 	// Check if any previous instance exists, cleanup if so
-	pvc, _ := utils.GetClientsetInstance().Cset.CoreV1().PersistentVolumeClaims(utils.Namespace).Get(context.Background(), utils.PodName, metav1.GetOptions{})
+	pvc, _ := utils.GetClientsetInstance().Cset.CoreV1().PersistentVolumeClaims(utils.Namespace).Get(ctx, utils.PodName, metav1.GetOptions{})
 
 	if pvc.Name != "" {
 		klog.Info("[PVC Create] Found pre-existing instance. Cleanup ", pvc.Name)
 		deletePVC(utils.PodName)
 		waitDelete := time.NewTimer(30 * time.Second)
-		<-waitDelete.C
+		select {
+		case <-waitDelete.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
 
-	_, err := cset.Cset.CoreV1().PersistentVolumeClaims(utils.Namespace).Create(context.TODO(), &pvcTemplate, metav1.CreateOptions{})
+	_, err := cset.Cset.CoreV1().PersistentVolumeClaims(utils.Namespace).Create(ctx, &pvcTemplate, metav1.CreateOptions{})
 
 	if err != nil {
 		klog.Info("[PVC Create] Failed. ABORT. ", err.Error())
@@ -1,18 +1,19 @@
 package healthcheck
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/IBM/autopilot/pkg/utils"
 	"k8s.io/klog/v2"
 )
 
 type HealthCheck string
 
-// Holding each test current status to facilitate node labeling
-var HealthCheckStatus map[HealthCheck]bool
-var defaultPeriodicChecks string = "pciebw,remapped,dcgm,ping,gpupower"
-
 const (
 	Undefined HealthCheck = ""
 	DCGM      HealthCheck = "dcgm"
@@ -29,24 +30,169 @@ func GetPeriodicChecks() string {
 	checks, exists := os.LookupEnv("PERIODIC_CHECKS")
 	if !exists {
 		klog.Info("Run all periodic health checks\n")
-		return defaultPeriodicChecks
+		return defaultPeriodicChecks()
 	}
 	return checks
 }
 
+// ExpandChecks splits a comma separated list of checks, replacing each "all" element with the periodic checks
+func ExpandChecks(checks string) []string {
+	expanded := []string{}
+	for _, check := range strings.Split(checks, ",") {
+		names := []string{check}
+		if check == "all" {
+			names = strings.Split(GetPeriodicChecks(), ",")
+		}
+		for _, name := range names {
+			if name != "" && name != "all" {
+				expanded = append(expanded, name)
+			}
+		}
+	}
+	return expanded
+}
+
+// listsCheck tells whether a comma separated list of checks names check as one of its elements
+func listsCheck(checks string, check HealthCheck) bool {
+	for _, c := range strings.Split(checks, ",") {
+		if c == string(check) {
+			return true
+		}
+	}
+	return false
+}
+
+// The registered checks flagged as periodic, as a comma separated list
+func defaultPeriodicChecks() string {
+	checks := []string{}
+	for _, c := range RegisteredChecks() {
+		if c.Metadata().Periodic {
+			checks = append(checks, string(c.Name()))
+		}
+	}
+	return strings.Join(checks, ",")
+}
+
+// envInt reads an integer of at least min from the environment variable name, def if it is not set or empty.
+// An invalid value returns def along with the error.
+func envInt(name string, def int, min int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min {
+		return def, fmt.Errorf("invalid %s %q: must be an integer of at least %d", name, value, min)
+	}
+	return n, nil
+}
+
+// envDuration reads a duration from the environment variable name, def if it is not set or empty.
+// An invalid value returns def along with the error.
+func envDuration(name string, def time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+	d, err := utils.ParseInterval(value)
+	if err != nil {
+		return def, fmt.Errorf("invalid %s %q: %w", name, value, err)
+	}
+	return d, nil
+}
+
+// InitSettings checks the settings read from the environment by the getters below, so that the daemon exits on
+// an invalid value, as with CHECK_TIMEOUTS, rather than running with the default.
+func InitSettings() error {
+	_, concurrencyErr := checkConcurrency()
+	_, queueSizeErr := checkQueueSize()
+	_, historySizeErr := historySize()
+	_, runRetentionErr := runRetention()
+	_, remoteRetriesErr := remoteRetries()
+	return errors.Join(concurrencyErr, queueSizeErr, historySizeErr, runRetentionErr, remoteRetriesErr)
+}
+
+// GetCheckConcurrency returns how many checks can run at the same time on the local node, from CHECK_CONCURRENCY. Defaults to 3
+func GetCheckConcurrency() int {
+	concurrency, _ := checkConcurrency()
+	return concurrency
+}
+
+func checkConcurrency() (int, error) {
+	return envInt("CHECK_CONCURRENCY", 3, 1)
+}
+
+// GetCheckQueueSize returns how many on-demand runs can wait for the health checks running on the local node,
+// from CHECK_QUEUE_SIZE. Defaults to 5, 0 disables the queue
+func GetCheckQueueSize() int {
+	size, _ := checkQueueSize()
+	return size
+}
+
+func checkQueueSize() (int, error) {
+	return envInt("CHECK_QUEUE_SIZE", 5, 0)
+}
+
+// Per check timeouts from CHECK_TIMEOUTS, e.g., "dcgm=1h,ping=5m"
+var checkTimeouts map[HealthCheck]time.Duration
+
+// InitCheckTimeouts reads the timeouts overriding the defaults of the checks. A zero duration disables the timeout.
+func InitCheckTimeouts() error {
+	timeouts, err := parseCheckDurations(os.Getenv("CHECK_TIMEOUTS"))
+	if err != nil {
+		return err
+	}
+	checkTimeouts = timeouts
+	return nil
+}
+
+func GetCheckTimeout(c Checker) time.Duration {
+	if timeout, found := checkTimeouts[c.Name()]; found {
+		return timeout
+	}
+	return c.Metadata().Timeout
+}
+
+// parseCheckDurations parses a comma separated list of check=duration entries, for registered checks or iperf
+func parseCheckDurations(list string) (map[HealthCheck]time.Duration, error) {
+	durations := make(map[HealthCheck]time.Duration)
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid entry %q: must be like 'check=duration'", entry)
+		}
+		check := HealthCheck(strings.TrimSpace(name))
+		if _, found := GetChecker(check); !found && check != Iperf {
+			return nil, fmt.Errorf("invalid entry %q: health check not supported: %s", entry, check)
+		}
+		d, err := utils.ParseInterval(strings.TrimSpace(value))
+		if err != nil {
+			return nil, err
+		}
+		durations[check] = d
+	}
+	return durations, nil
+}
+
+// InitNodeStatusMap initializes the state store with the periodic checks
 func InitNodeStatusMap() {
-	HealthCheckStatus = make(map[HealthCheck]bool)
-	checklist := GetPeriodicChecks()
-	for _, v := range strings.Split(checklist, ",") {
+	checks := []HealthCheck{}
+	for _, v := range strings.Split(GetPeriodicChecks(), ",") {
+		if _, found := GetChecker(HealthCheck(v)); !found {
+			klog.Info("Health check not supported, skipping: ", v)
+			continue
+		}
 		klog.Info("Init entry map ", v)
-		HealthCheckStatus[HealthCheck(v)] = false
+		checks = append(checks, HealthCheck(v))
 	}
+	State.Init(checks)
 }
 
+// GetNodeStatus tells whether any check counts against the node health
 func GetNodeStatus() bool {
-	hasFailures := false
-	for v := range HealthCheckStatus {
-		hasFailures = hasFailures || HealthCheckStatus[v]
-	}
-	return hasFailures
+	return State.Failed()
 }
@@ -0,0 +1,125 @@
+package healthcheck
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/IBM/autopilot/pkg/utils"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var update = flag.Bool("update", false, "update the golden files of the health checks")
+
+// replayExecutor returns recorded outputs instead of running commands
+type replayExecutor struct {
+	stdout []byte
+	stderr []byte
+	err    error
+}
+
+func (e replayExecutor) Run(ctx context.Context, env []string, name string, args ...string) ([]byte, []byte, error) {
+	return e.stdout, e.stderr, e.err
+}
+
+type goldenGauge struct {
+	Health   string  `json:"health"`
+	DeviceID string  `json:"deviceid"`
+	Value    float64 `json:"value"`
+}
+
+// golden is what a check run on a recorded output is expected to produce
+type golden struct {
+	Status CheckStatus   `json:"status"`
+	Error  string        `json:"error,omitempty"`
+	Gauge  []goldenGauge `json:"gauge"`
+	Label  string        `json:"label"`
+}
+
+// TestGolden runs the checks on the outputs recorded in testdata/<check>/<case>.stdout (and .stderr, if any),
+// and compares statuses, gauge values and node label decisions with testdata/<check>/<case>.golden.
+// Run with -update to regenerate the golden files.
+func TestGolden(t *testing.T) {
+	defer func(e Executor) { CommandExecutor = e }(CommandExecutor)
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(utils.HchecksGauge)
+	defer reg.Unregister(utils.HchecksGauge)
+	utils.UserConfig.BWThreshold = 4
+
+	recorded, err := filepath.Glob("testdata/*/*.stdout")
+	if err != nil || len(recorded) == 0 {
+		t.Fatalf("No recorded outputs found: %v", err)
+	}
+	for _, path := range recorded {
+		check := HealthCheck(filepath.Base(filepath.Dir(path)))
+		name := string(check) + "/" + strings.TrimSuffix(filepath.Base(path), ".stdout")
+		t.Run(name, func(t *testing.T) {
+			c, found := GetChecker(check)
+			if !found {
+				t.Fatalf("Health check %s not registered", check)
+			}
+			stdout, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stderr, _ := os.ReadFile(strings.TrimSuffix(path, ".stdout") + ".stderr")
+			CommandExecutor = replayExecutor{stdout: stdout, stderr: stderr}
+			State = NewStateStore()
+			utils.HchecksGauge.Reset()
+
+			result, err := RunCheck(context.Background(), c, url.Values{})
+			got := golden{Status: result.Status, Gauge: []goldenGauge{}, Label: "PASS"}
+			if err != nil {
+				got.Error = err.Error()
+			}
+			if NodeHealthLabel() == utils.GPUHealthWarnLabel {
+				got.Label = "WARN"
+			}
+			families, err := reg.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, family := range families {
+				for _, m := range family.GetMetric() {
+					g := goldenGauge{Value: m.GetGauge().GetValue()}
+					for _, l := range m.GetLabel() {
+						switch l.GetName() {
+						case "health":
+							g.Health = l.GetValue()
+						case "deviceid":
+							g.DeviceID = l.GetValue()
+						}
+					}
+					got.Gauge = append(got.Gauge, g)
+				}
+			}
+
+			goldenPath := strings.TrimSuffix(path, ".stdout") + ".golden"
+			if *update {
+				out, _ := json.MarshalIndent(got, "", "  ")
+				if err := os.WriteFile(goldenPath, append(out, '\n'), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			content, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("Missing golden file, run with -update: %v", err)
+			}
+			var expected golden
+			if err := json.Unmarshal(content, &expected); err != nil {
+				t.Fatal(err)
+			}
+			gotJSON, _ := json.Marshal(got)
+			expectedJSON, _ := json.Marshal(expected)
+			if string(gotJSON) != string(expectedJSON) {
+				t.Errorf("Expected %s, got %s", expectedJSON, gotJSON)
+			}
+		})
+	}
+}
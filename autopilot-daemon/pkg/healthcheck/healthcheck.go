@@ -1,455 +1,542 @@
 package healthcheck
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
 	"os"
-	"os/exec"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/IBM/autopilot/pkg/utils"
 	"k8s.io/klog/v2"
 )
 
-func PeriodicCheck() {
-	klog.Info("Running a periodic check")
-	utils.HealthcheckLock.Lock()
+// PeriodicCheck runs the given comma separated checks, then updates the node label from the status of all checks
+func PeriodicCheck(ctx context.Context, checks string) {
+	klog.Info("Running a periodic check: ", checks)
+	if err := utils.HealthcheckLock.Wait(ctx, checks, -1, nil); err != nil {
+		klog.Info("Periodic check of ", checks, " not started: ", err.Error())
+		return
+	}
 	defer utils.HealthcheckLock.Unlock()
-	checks := GetPeriodicChecks()
-	RunHealthLocalNode(checks, "1", "None", "None", nil)
-	hasFailures := GetNodeStatus()
-	klog.Info("Errors after running periodic health checks: ", hasFailures)
-	if hasFailures {
-		utils.PatchNode(utils.GPUHealthWarnLabel, utils.NodeName, true)
-	} else {
-		utils.PatchNode(utils.GPUHealthPassLabel, utils.NodeName, true)
+	RunHealthLocalNode(ctx, checks, "1", "None", "None", nil)
+	if ctx.Err() != nil {
+		klog.Info("Periodic check of ", checks, " interrupted, node label not updated")
+		return
+	}
+	klog.Info("Errors after running periodic health checks: ", GetNodeStatus())
+	utils.PatchNode(NodeHealthLabel(), utils.NodeName, true)
+}
+
+// NodeHealthLabel returns the patch of the gpuhealth node label matching the state of the checks
+func NodeHealthLabel() string {
+	if GetNodeStatus() {
+		return utils.GPUHealthWarnLabel
 	}
+	return utils.GPUHealthPassLabel
 }
 
-func InvasiveCheck() {
+func InvasiveCheck(ctx context.Context) {
 	klog.Info("Trying to run an invasive check")
-	utils.HealthcheckLock.Lock()
+	if err := utils.HealthcheckLock.Wait(ctx, "invasive", -1, nil); err != nil {
+		klog.Info("Invasive check not run: ", err.Error())
+		return
+	}
 	defer utils.HealthcheckLock.Unlock()
-	if utils.GPUsAvailability() {
-		klog.Info("Starting invasive health checks, updating node label =TESTING for node ", utils.NodeName)
-		utils.PatchNode(utils.GPUHealthTestingLabel, utils.NodeName, true)
-		err := utils.CreateJob("dcgm")
-		if err != nil {
-			klog.Info("Invasive health checks Job creation failed, reset node label for node ", utils.NodeName)
-			utils.PatchNode(utils.GPUHealthEmptyLabel, utils.NodeName, true)
-		}
+	RunInvasiveCheck()
+}
+
+// The last invasive health checks Job created by the daemon, see StopInvasiveJob
+var invasiveJob struct {
+	sync.Mutex
+	name string
+}
+
+// Returned by RunInvasiveCheck when the GPUs of the node are in use
+var ErrGPUsBusy = errors.New("GPUs busy, cannot run invasive health checks")
+
+// RunInvasiveCheck launches the invasive health checks Job, if the GPUs of the node are free.
+// The caller must hold the health check lock.
+func RunInvasiveCheck() error {
+	if !utils.GPUsAvailability() {
+		return ErrGPUsBusy
+	}
+	klog.Info("Starting invasive health checks, updating node label =TESTING for node ", utils.NodeName)
+	utils.SetGPUHealthTesting(utils.NodeName)
+	name, err := utils.CreateJob("dcgm")
+	if err != nil {
+		klog.Info("Invasive health checks Job creation failed, reset node label for node ", utils.NodeName)
+		utils.PatchNode(utils.GPUHealthEmptyLabel, utils.NodeName, true)
+		return err
 	}
+	invasiveJob.Lock()
+	defer invasiveJob.Unlock()
+	invasiveJob.name = name
+	return nil
 }
 
-func RunHealthLocalNode(checks string, dcgmR string, jobName string, nodelabel string, r *http.Request) (*[]byte, error) {
-	out := []byte("")
-	var tmp *[]byte
-	var err error
-	start := time.Now()
-	if strings.Contains(checks, "all") {
-		checks = GetPeriodicChecks()
+// StopInvasiveJob deletes the last invasive health checks Job, and waits until its pod is gone and the GPUs are free,
+// or until ctx is done
+func StopInvasiveJob(ctx context.Context) error {
+	invasiveJob.Lock()
+	defer invasiveJob.Unlock()
+	if invasiveJob.name == "" {
+		return nil
 	}
-	klog.Info("Health checks ", checks)
-	for _, check := range strings.Split(checks, ",") {
-		switch check {
-		case string(Ping):
-			klog.Info("Running health check: ", check)
-			pingnodes := "all"
-			if r != nil {
-				pingnodes = r.URL.Query().Get("pingnodes")
-				if pingnodes == "" {
-					pingnodes = "all"
-				}
-			}
-			tmp, err = RunPing(pingnodes, jobName, nodelabel)
-			if err != nil {
-				klog.Error(err.Error())
-				return tmp, err
-			}
-			out = append(out, *tmp...)
-
-		case string(DCGM):
-			klog.Info("Running health check: ", check, " -r ", dcgmR)
-			tmp, err = RunDCGM(dcgmR)
-			if err != nil {
-				klog.Error(err.Error())
-				return tmp, err
-			}
-			out = append(out, *tmp...)
-
-		case string(PCIeBW):
-			klog.Info("Running health check: ", check)
-			tmp, err = RunPCIeBW()
-			if err != nil {
-				klog.Error(err.Error())
-				return tmp, err
-			}
-			out = append(out, *tmp...)
-
-		case string(RowRemap):
-			klog.Info("Running health check: ", check)
-			tmp, err = RunRemappedRows()
-			if err != nil {
-				klog.Error(err.Error())
-				return tmp, err
-			}
-			out = append(out, *tmp...)
-
-		case string(GPUPower):
-			klog.Info("Running health check: ", check)
-			tmp, err = RunGPUPower()
-			if err != nil {
-				klog.Error(err.Error())
-				return tmp, err
-			}
-			out = append(out, *tmp...)
-
-		case string(GPUMem):
-			klog.Info("Running health check: ", check)
-			tmp, err = RunGPUMem()
-			if err != nil {
-				klog.Error(err.Error())
-				return tmp, err
-			}
-			out = append(out, *tmp...)
-
-		case string(PVC):
-			klog.Info("Running health check: ", check)
-			tmp, err = RunCreateDeletePVC()
-			if err != nil {
-				klog.Error(err.Error())
-				return tmp, err
-			}
-			out = append(out, *tmp...)
+	klog.Info("Deleting the invasive health checks Job ", invasiveJob.name)
+	if err := utils.DeleteJob(ctx, invasiveJob.name); err != nil {
+		return err
+	}
+	invasiveJob.name = ""
+	return nil
+}
 
-		default:
-			notsupported := "check not supported: " + check
-			out = append(out, []byte(notsupported)...)
+// RunHealthLocalNode runs the given comma separated checks on the local node. Concurrent checks run in parallel,
+// up to CHECK_CONCURRENCY at a time, while the other checks run one after another in a single slot of the pool.
+// Results are returned in the order of the checks.
+func RunHealthLocalNode(ctx context.Context, checks string, dcgmR string, jobName string, nodelabel string, r *http.Request) ([]*CheckResult, error) {
+	start := time.Now()
+	checks = strings.Join(ExpandChecks(checks), ",")
+	klog.Info("Health checks ", checks)
+	params := url.Values{}
+	if r != nil {
+		params = r.URL.Query()
+	}
+	// "host" selects where to run the checks, "stream" how to return their output and "wait" whether to queue,
+	// they are not parameters of the checks themselves
+	params.Del("host")
+	params.Del("stream")
+	params.Del("wait")
+	params.Set("r", dcgmR)
+	params.Set("job", jobName)
+	params.Set("nodelabel", nodelabel)
+
+	checklist := strings.Split(checks, ",")
+	results := make([]*CheckResult, len(checklist))
+	errs := make([]error, len(checklist))
+	pool := make(chan struct{}, GetCheckConcurrency())
+	var wg sync.WaitGroup
+	exclusive := []int{}
+	checkers := make([]Checker, len(checklist))
+	for i, check := range checklist {
+		c, found := GetChecker(HealthCheck(check))
+		if !found {
+			results[i] = newCheckResult(HealthCheck(check)).finish([]byte("check not supported: " + check))
+			results[i].Status = StatusError
+			continue
 		}
+		checkers[i] = c
+		if !c.Metadata().Concurrent {
+			exclusive = append(exclusive, i)
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			pool <- struct{}{}
+			defer func() { <-pool }()
+			results[i], errs[i] = RunCheck(ctx, checkers[i], params)
+		}(i)
+	}
+	if len(exclusive) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pool <- struct{}{}
+			defer func() { <-pool }()
+			for _, i := range exclusive {
+				results[i], errs[i] = RunCheck(ctx, checkers[i], params)
+			}
+		}()
 	}
+	wg.Wait()
 
 	end := time.Now()
 	diff := end.Sub(start)
 	klog.Info("Total time (s) for all checks: ", diff.Seconds())
-	return &out, nil
+	return results, errors.Join(errs...)
 }
 
-func RunHealthRemoteNodes(host string, check string, batch string, jobName string, dcgmR string, nodelabel string) (*[]byte, error) {
-	klog.Info("About to run command:\n", "./utils/runHealthchecks.py", " --nodes="+host, " --check="+check, " --batchSize="+batch, " --wkload="+jobName, " --dcgmR="+dcgmR, " --nodelabel="+nodelabel)
-
-	out, err := exec.Command("python3", "./utils/runHealthchecks.py", "--service=autopilot-healthchecks", "--namespace="+utils.Namespace, "--nodes="+host, "--check="+check, "--batchSize="+batch, "--wkload="+jobName, "--dcgmR="+dcgmR, "--nodelabel="+nodelabel).Output()
+func RunRemappedRows(ctx context.Context) (*CheckResult, error) {
+	result := newCheckResult(RowRemap)
+	stdout, stderr, err := runScript(ctx, "python3", "./gpu-remapped/entrypoint.py")
 	if err != nil {
-		klog.Info(string(out))
-		klog.Error(err.Error())
-		return nil, err
+		out := append(stderr, stdout...)
+		klog.Info("Out:", string(out))
+		return result.finish(out), err
 	}
-
-	return &out, nil
+	klog.Info("Remapped Rows check test completed:")
+	return parseOutput(result, stdout, stderr, parseRemappedRows)
 }
 
-func RunRemappedRows() (*[]byte, error) {
-	HealthCheckStatus[RowRemap] = false
-	out, err := exec.Command("python3", "./gpu-remapped/entrypoint.py").CombinedOutput()
-	if err != nil {
-		klog.Info("Out:", string(out))
-		klog.Error(err.Error())
-		return nil, err
-	} else {
-		klog.Info("Remapped Rows check test completed:")
-
-		if strings.Contains(string(out[:]), "FAIL") {
-			klog.Info("Remapped Rows test failed.", string(out[:]))
-			HealthCheckStatus[RowRemap] = true
-		}
+// The last line of the output has one entry per GPU, 1 if the GPU has pending remapped rows
+func parseRemappedRows(result *CheckResult, out []byte) (*CheckResult, error) {
+	defer result.finish(out)
+	if strings.Contains(string(out[:]), "FAIL") {
+		klog.Info("Remapped Rows test failed.", string(out[:]))
+		result.Status = StatusFail
+	}
 
-		if strings.Contains(string(out[:]), "ABORT") {
-			klog.Info("Remapped Rows cannot be run. ", string(out[:]))
-			return &out, nil
-		}
+	if strings.Contains(string(out[:]), "ABORT") {
+		klog.Info("Remapped Rows cannot be run. ", string(out[:]))
+		abort(result)
+		return result, nil
+	}
 
-		output := strings.TrimSuffix(string(out[:]), "\n")
-		split := strings.Split(output, "\n")
-		rmr := split[len(split)-1]
-		final := strings.Split(rmr, " ")
-
-		for gpuid, v := range final {
-			rm, err := strconv.ParseFloat(v, 64)
-			if err != nil {
-				klog.Error(err.Error())
-				return nil, err
-			} else {
-				klog.Info("Observation: ", utils.NodeName, " ", strconv.Itoa(gpuid), " ", rm)
-				utils.HchecksGauge.WithLabelValues(string(RowRemap), utils.NodeName, utils.CPUModel, utils.GPUModel, strconv.Itoa(gpuid)).Set(rm)
-			}
-		}
+	values, err := parseLastLine(out)
+	if err != nil {
+		return result, err
+	}
+	for gpuid, rm := range values {
+		result.addObservation(strconv.Itoa(gpuid), rm, "")
 	}
-	return &out, nil
+	return result, nil
 }
 
-func RunGPUMem() (*[]byte, error) {
-	HealthCheckStatus[GPUMem] = false
-	out, err := exec.Command("python3", "./gpu-mem/entrypoint.py").CombinedOutput()
+func RunGPUMem(ctx context.Context) (*CheckResult, error) {
+	result := newCheckResult(GPUMem)
+	stdout, stderr, err := runScript(ctx, "python3", "./gpu-mem/entrypoint.py")
 	if err != nil {
+		out := append(stderr, stdout...)
 		klog.Info("Out:", string(out))
-		klog.Error(err.Error())
-		return nil, err
-	} else {
-		klog.Info("GPU Memory check completed:")
-
-		if strings.Contains(string(out[:]), "FAIL") {
-			klog.Info("GPU Memory check failed.", string(out[:]))
-			klog.Info("Observation: ", utils.NodeName, " 1")
-			utils.HchecksGauge.WithLabelValues(string(GPUMem), utils.NodeName, utils.CPUModel, utils.GPUModel, "0").Set(1)
-			HealthCheckStatus[GPUMem] = true
-		}
+		return result.finish(out), err
+	}
+	klog.Info("GPU Memory check completed:")
+	return parseOutput(result, stdout, stderr, parseGPUMem)
+}
 
-		if strings.Contains(string(out[:]), "ABORT") {
-			klog.Info("GPU Memory check cannot be run. ", string(out[:]))
-			return &out, nil
-		}
+func parseGPUMem(result *CheckResult, out []byte) (*CheckResult, error) {
+	defer result.finish(out)
+	if strings.Contains(string(out[:]), "FAIL") {
+		klog.Info("GPU Memory check failed.", string(out[:]))
+		result.Status = StatusFail
+		result.addObservation("0", 1, "")
+		return result, nil
+	}
 
-		klog.Info("Observation: ", utils.NodeName, " 0")
-		utils.HchecksGauge.WithLabelValues(string(GPUMem), utils.NodeName, utils.CPUModel, utils.GPUModel, "0").Set(0)
+	if strings.Contains(string(out[:]), "ABORT") {
+		klog.Info("GPU Memory check cannot be run. ", string(out[:]))
+		abort(result)
+		return result, nil
 	}
-	return &out, nil
+
+	result.addObservation("0", 0, "")
+	return result, nil
 }
 
-func RunPCIeBW() (*[]byte, error) {
-	HealthCheckStatus[PCIeBW] = false
-	out, err := exec.Command("python3", "./gpu-bw/entrypoint.py", "-t", strconv.Itoa(utils.UserConfig.BWThreshold)).CombinedOutput()
+func RunPCIeBW(ctx context.Context) (*CheckResult, error) {
+	result := newCheckResult(PCIeBW)
+	threshold := PCIeBWThreshold()
+	stdout, stderr, err := runScript(ctx, "python3", "./gpu-bw/entrypoint.py", "-t", strconv.FormatFloat(threshold, 'f', -1, 64))
 	if err != nil {
+		out := append(stderr, stdout...)
 		klog.Info("Out:", string(out))
-		klog.Error(err.Error())
-		return nil, err
-	} else {
-		klog.Info("GPU PCIe BW test completed:")
+		return result.finish(out), err
+	}
+	klog.Info("GPU PCIe BW test completed:")
+	return parseOutput(result, stdout, stderr, func(result *CheckResult, out []byte) (*CheckResult, error) {
+		return parsePCIeBW(result, out, threshold)
+	})
+}
 
-		if strings.Contains(string(out[:]), "FAIL") {
-			klog.Info("PCIe BW test failed.", string(out[:]))
-			HealthCheckStatus[PCIeBW] = true
-		}
+// The last line of the output has the measured bandwidth of each GPU
+func parsePCIeBW(result *CheckResult, out []byte, threshold float64) (*CheckResult, error) {
+	defer result.finish(out)
+	if strings.Contains(string(out[:]), "FAIL") {
+		klog.Info("PCIe BW test failed.", string(out[:]))
+		result.Status = StatusFail
+	}
 
-		if strings.Contains(string(out[:]), "ABORT") {
-			klog.Info("PCIe BW cannot be run. ", string(out[:]))
-			return &out, nil
-		}
+	if strings.Contains(string(out[:]), "ABORT") {
+		klog.Info("PCIe BW cannot be run. ", string(out[:]))
+		abort(result)
+		return result, nil
+	}
 
-		output := strings.TrimSuffix(string(out[:]), "\n")
-		split := strings.Split(output, "\n")
-
-		bws := split[len(split)-1]
-		final := strings.Split(bws, " ")
-
-		for gpuid, v := range final {
-			bw, err := strconv.ParseFloat(v, 64)
-			if err != nil {
-				klog.Error(err.Error())
-				return nil, err
-			} else {
-				logline := "Observation: " + utils.NodeName + " " + strconv.Itoa(gpuid) + " " + v
-				if bw < float64(utils.UserConfig.BWThreshold) {
-					logline += "  [[ LOW PCIE -- Below expected threshold of " + strconv.Itoa(utils.UserConfig.BWThreshold) + " Gb/s ]]"
-					HealthCheckStatus[PCIeBW] = true
-				}
-				klog.Info(logline)
-				utils.HchecksGauge.WithLabelValues(string(PCIeBW), utils.NodeName, utils.CPUModel, utils.GPUModel, strconv.Itoa(gpuid)).Set(bw)
-			}
+	values, err := parseLastLine(out)
+	if err != nil {
+		return result, err
+	}
+	for gpuid, bw := range values {
+		if bw < threshold {
+			klog.Info("GPU ", gpuid, " [[ LOW PCIE -- Below expected threshold of ", threshold, " Gb/s ]]")
+			result.Status = StatusFail
 		}
+		result.Observations = append(result.Observations, Observation{
+			DeviceID:  strconv.Itoa(gpuid),
+			Value:     bw,
+			Unit:      "GB/s",
+			Threshold: &threshold,
+		})
 	}
-	return &out, nil
+	return result, nil
 }
 
-func RunPing(nodelist string, jobName string, nodelabel string) (*[]byte, error) {
-	HealthCheckStatus[Ping] = false
-	out, err := exec.Command("python3", "./network/ping-entrypoint.py", "--nodes", nodelist, "--job", jobName, "--nodelabel", nodelabel).CombinedOutput()
+func RunPing(ctx context.Context, nodelist string, jobName string, nodelabel string) (*CheckResult, error) {
+	result := newCheckResult(Ping)
+	stdout, stderr, err := runScript(ctx, "python3", "./network/ping-entrypoint.py", "--nodes", nodelist, "--job", jobName, "--nodelabel", nodelabel)
 	if err != nil {
+		out := append(stderr, stdout...)
 		klog.Info(string(out))
-		klog.Error(err.Error())
-		return nil, err
-	} else {
-		klog.Info("Ping test completed:")
+		return result.finish(out), err
+	}
+	klog.Info("Ping test completed:")
+	return parseOutput(result, stdout, stderr, parsePing)
+}
 
-		if strings.Contains(string(out[:]), "FAIL") {
-			klog.Info("Ping test failed.", string(out[:]))
-			HealthCheckStatus[PCIeBW] = true
-		}
+// Each line "Node <name> <ip> <iface> <0|1>" is the outcome of pinging one interface of a remote node.
+// A node is reported as unreachable (1) if any of its interfaces is unreachable.
+func parsePing(result *CheckResult, out []byte) (*CheckResult, error) {
+	defer result.finish(out)
+	if strings.Contains(string(out[:]), "FAIL") {
+		klog.Info("Ping test failed.", string(out[:]))
+		result.Status = StatusFail
+	}
 
-		if strings.Contains(string(out[:]), "ABORT") {
-			klog.Info("Ping cannot be run. ", string(out[:]))
-			return &out, nil
-		}
+	if strings.Contains(string(out[:]), "ABORT") {
+		klog.Info("Ping cannot be run. ", string(out[:]))
+		abort(result)
+		return result, nil
+	}
 
-		output := strings.TrimSuffix(string(out[:]), "\n")
-		lines := strings.Split(output, "\n")
-		unreach_nodes := make(map[string][]string)
-		for _, line := range lines {
-			if strings.HasPrefix(line, "Node") {
-				entry := strings.Split(line, " ")
-				if _, exists := unreach_nodes[entry[1]]; !exists {
-					if entry[len(entry)-1] == "1" {
-						utils.HchecksGauge.WithLabelValues(string(Ping), utils.NodeName, utils.CPUModel, utils.GPUModel, entry[1]).Set(float64(1))
-						klog.Info("Observation: ", entry[1], " ", entry[2], " ", entry[3], " Unreachable")
-						unreach_nodes[entry[1]] = append(unreach_nodes[entry[1]], entry[2])
-					} else {
-						utils.HchecksGauge.WithLabelValues(string(Ping), utils.NodeName, utils.CPUModel, utils.GPUModel, entry[1]).Set(float64(0))
-					}
-				}
-			}
+	output := strings.TrimSuffix(string(out[:]), "\n")
+	lines := strings.Split(output, "\n")
+	nodes := []string{}
+	unreach_nodes := make(map[string]float64)
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "Node") {
+			continue
 		}
-		klog.Info("Unreachable nodes count: ", len(unreach_nodes))
+		entry := strings.Split(line, " ")
+		if len(entry) < 5 {
+			continue
+		}
+		if _, exists := unreach_nodes[entry[1]]; !exists {
+			nodes = append(nodes, entry[1])
+			unreach_nodes[entry[1]] = 0
+		}
+		if entry[len(entry)-1] == "1" {
+			klog.Info("Observation: ", entry[1], " ", entry[2], " ", entry[3], " Unreachable")
+			unreach_nodes[entry[1]] = 1
+		}
+	}
+	unreachable := 0
+	for _, node := range nodes {
+		if unreach_nodes[node] == 1 {
+			unreachable++
+		}
+		result.addObservation(node, unreach_nodes[node], "")
+	}
+	klog.Info("Unreachable nodes count: ", unreachable)
+	return result, nil
+}
+
+// Default deadline of the iperf workload and of the scripts managing its servers and clients, overridden by
+// "iperf" in CHECK_TIMEOUTS
+const defaultIperfTimeout = time.Hour
+
+func GetIperfTimeout() time.Duration {
+	if timeout, found := checkTimeouts[Iperf]; found {
+		return timeout
+	}
+	return defaultIperfTimeout
+}
+
+// runIperfScript runs an iperf script through the command executor, until it exits, ctx is done or the iperf timeout
+// expires. The script and all its children are killed then. Returns the output of the script, even if it failed.
+func runIperfScript(ctx context.Context, args ...string) (*[]byte, error) {
+	timeout := GetIperfTimeout()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	stdout, stderr, err := CommandExecutor.Run(ctx, nil, "python3", args...)
+	out := append(stdout, stderr...)
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		utils.HchecksTimeouts.WithLabelValues(string(Iperf), utils.NodeName).Inc()
+		err = fmt.Errorf("%s %s after %s", args[0], StatusTimeout, timeout)
+	case context.Canceled:
+		err = fmt.Errorf("%s cancelled", args[0])
+	}
+	if err != nil {
+		klog.Info(string(out))
+		klog.Error(err.Error())
 	}
-	return &out, nil
+	return &out, err
 }
 
-func RunIperf(workload string, pclients string, startport string, cleanup string) (*[]byte, error) {
+func RunIperf(ctx context.Context, workload string, pclients string, startport string, cleanup string) (*[]byte, error) {
 
 	args := []string{"./network/iperf3_entrypoint.py", "--workload", workload, "--pclients", pclients, "--startport", startport}
 
 	if cleanup != "" {
 		args = append(args, cleanup)
 	}
-	out, err := exec.Command("python3", args...).CombinedOutput()
-	if err != nil {
-		return nil, err
+	out, err := runIperfScript(ctx, args...)
+	if err == nil {
+		klog.Info("iperf3 test completed:\n", string(*out))
 	}
-	klog.Info("iperf3 test completed:\n", string(out))
-	return &out, nil
+	return out, err
 }
 
-func StartIperfServers(numservers string, startport string) (*[]byte, error) {
-	out, err := exec.Command("python3", "./network/iperf3_start_servers.py", "--numservers", numservers, "--startport", startport).CombinedOutput()
-	if err != nil {
-		klog.Info(string(out))
-		klog.Error(err.Error())
-		return nil, err
-	} else {
+func StartIperfServers(ctx context.Context, numservers string, startport string) (*[]byte, error) {
+	out, err := runIperfScript(ctx, "./network/iperf3_start_servers.py", "--numservers", numservers, "--startport", startport)
+	if err == nil {
 		klog.Info("iperf3 servers started.")
 	}
-	return &out, nil
+	return out, err
 }
 
-func StopAllIperfServers() (*[]byte, error) {
-	out, err := exec.Command("python3", "./network/iperf3_stop_servers.py").CombinedOutput()
-	if err != nil {
-		klog.Info(string(out))
-		klog.Error(err.Error())
-		return nil, err
-	} else {
+func StopAllIperfServers(ctx context.Context) (*[]byte, error) {
+	out, err := runIperfScript(ctx, "./network/iperf3_stop_servers.py")
+	if err == nil {
 		klog.Info("iperf3 servers stopped.")
 	}
-	return &out, nil
+	return out, err
 }
 
-func StartIperfClients(dstip string, dstport string, numclients string) (*[]byte, error) {
+func StartIperfClients(ctx context.Context, dstip string, dstport string, numclients string) (*[]byte, error) {
 	if dstip == "" || dstport == "" || numclients == "" {
 		klog.Error("Must provide arguments \"dstip\", \"dstport\", and \"startport\".")
 		return nil, nil
 	}
 
-	out, err := exec.Command("python3", "./network/iperf3_start_clients.py", "--dstip", dstip, "--dstport", dstport, "--numclients", numclients).CombinedOutput()
-	if err != nil {
-		klog.Info(string(out))
-		klog.Error(err.Error())
-		return nil, err
-	} else {
+	out, err := runIperfScript(ctx, "./network/iperf3_start_clients.py", "--dstip", dstip, "--dstport", dstport, "--numclients", numclients)
+	if err == nil {
 		klog.Info("iperf3 clients started.")
 	}
-	return &out, nil
+	return out, err
 }
 
-func RunDCGM(dcgmR string) (*[]byte, error) {
-	HealthCheckStatus[DCGM] = false
-	out, err := exec.Command("python3", "./gpu-dcgm/entrypoint.py", "-r", dcgmR, "-l").Output()
+func RunDCGM(ctx context.Context, dcgmR string) (*CheckResult, error) {
+	result := newCheckResult(DCGM)
+	stdout, _, err := runScript(ctx, "python3", "./gpu-dcgm/entrypoint.py", "-r", dcgmR, "-l")
 	if err != nil {
-		klog.Error(err.Error())
-		return nil, err
-	} else {
-		klog.Info("DCGM test completed:")
+		return result.finish(stdout), err
+	}
+	klog.Info("DCGM test completed:")
+	return parseOutput(result, stdout, nil, parseDCGM)
+}
 
-		if strings.Contains(string(out[:]), "ERR") {
-			klog.Info("DCGM test exited with errors.", string(out[:]))
-		}
+// The last line of the output reports SUCCESS if no diagnostic failed
+func parseDCGM(result *CheckResult, out []byte) (*CheckResult, error) {
+	defer result.finish(out)
+	if strings.Contains(string(out[:]), "ERR") {
+		klog.Info("DCGM test exited with errors.", string(out[:]))
+	}
 
-		if strings.Contains(string(out[:]), "ABORT") {
-			klog.Info("DCGM cannot be run. ", string(out[:]))
-			return &out, nil
-		}
-		output := strings.TrimSuffix(string(out[:]), "\n")
-		split := strings.Split(output, "\n")
-		var res float64
-		res = 0
-		if strings.Contains(split[len(split)-1], "SUCCESS") {
-			klog.Info("Observation: ", utils.NodeName, " Pass ", res)
-		} else {
-			res = 1
-			klog.Info("Observation: ", utils.NodeName, " Fail ", res)
-			HealthCheckStatus[DCGM] = true
-		}
-		utils.HchecksGauge.WithLabelValues(string(DCGM), utils.NodeName, utils.CPUModel, utils.GPUModel, "").Set(res)
+	if strings.Contains(string(out[:]), "ABORT") {
+		klog.Info("DCGM cannot be run. ", string(out[:]))
+		abort(result)
+		return result, nil
+	}
+	output := strings.TrimSuffix(string(out[:]), "\n")
+	split := strings.Split(output, "\n")
+	if strings.Contains(split[len(split)-1], "SUCCESS") {
+		result.addObservation("", 0, "")
+	} else {
+		result.Status = StatusFail
+		result.addObservation("", 1, "")
 	}
-	return &out, nil
+	return result, nil
 }
 
-func RunGPUPower() (*[]byte, error) {
-	HealthCheckStatus[GPUPower] = false
-	out, err := exec.Command("bash", "./gpu-power/power-throttle.sh").Output()
+func RunGPUPower(ctx context.Context) (*CheckResult, error) {
+	result := newCheckResult(GPUPower)
+	stdout, _, err := runScript(ctx, "bash", "./gpu-power/power-throttle.sh")
 	if err != nil {
-		klog.Error(err.Error())
-		return nil, err
+		return result.finish(stdout), err
 	}
 	klog.Info("Power Throttle check test completed:")
+	return parseOutput(result, stdout, nil, parseGPUPower)
+}
 
+// The last line of the output has one entry per GPU, 1 if hardware slowdown is active
+func parseGPUPower(result *CheckResult, out []byte) (*CheckResult, error) {
+	defer result.finish(out)
 	if strings.Contains(string(out[:]), "FAIL") {
 		klog.Info("Power Throttle test failed.", string(out[:]))
-		HealthCheckStatus[GPUPower] = true
+		result.Status = StatusFail
 	}
 
 	if strings.Contains(string(out[:]), "ABORT") {
 		klog.Info("Power Throttle cannot be run. ", string(out[:]))
-		return &out, nil
+		abort(result)
+		return result, nil
 	}
 
-	output := strings.TrimSuffix(string(out[:]), "\n")
-	split := strings.Split(output, "\n")
-	pwrs := split[len(split)-1]
-	final := strings.Split(pwrs, " ")
-
-	for gpuid, v := range final {
-		pw, err := strconv.ParseFloat(v, 64)
-		if err != nil {
-			klog.Error(err.Error())
-			return nil, err
-		}
-		klog.Info("Observation: ", utils.NodeName, " ", strconv.Itoa(gpuid), " ", pw)
-		utils.HchecksGauge.WithLabelValues("power-slowdown", utils.NodeName, utils.CPUModel, utils.GPUModel, strconv.Itoa(gpuid)).Set(pw)
-
+	values, err := parseLastLine(out)
+	if err != nil {
+		return result, err
+	}
+	for gpuid, pw := range values {
+		result.addObservation(strconv.Itoa(gpuid), pw, "")
 	}
-	return &out, nil
+	return result, nil
 }
 
-func RunCreateDeletePVC() (*[]byte, error) {
+func RunCreateDeletePVC(ctx context.Context) (*CheckResult, error) {
+	result := newCheckResult(PVC)
 	_, exists := os.LookupEnv("PVC_TEST_STORAGE_CLASS")
 	if !exists {
-		b := []byte("Storage class not set. Cannot run. ABORT")
-		return &b, errors.New("storage class not set")
+		result.Status = StatusAbort
+		return result.finish([]byte("Storage class not set. Cannot run. ABORT")), errors.New("storage class not set")
 	}
-	HealthCheckStatus[PVC] = false
-	err := createPVC()
+	err := createPVC(ctx)
 	if err != nil {
 		klog.Error(err.Error())
-		b := []byte("Create PVC Failed. ABORT")
-		return &b, err
+		result.Status = StatusAbort
+		return result.finish([]byte("Create PVC Failed. ABORT")), err
 	}
 	// Wait a few seconds before start checking
 	waitonpvc := time.NewTicker(30 * time.Second)
 	defer waitonpvc.Stop()
-	<-waitonpvc.C
-	out, err := ListPVC()
+	select {
+	case <-waitonpvc.C:
+	case <-ctx.Done():
+		deletePVC(utils.PodName)
+		return result.finish([]byte("[PVC Create-Delete] Interrupted. ABORT")), ctx.Err()
+	}
+	status, out, err := ListPVC(ctx)
 	if err != nil {
 		klog.Error(err.Error())
 	}
-	b := []byte(out)
-	return &b, nil
+	result.Status = status
+	switch status {
+	case StatusPass:
+		result.addObservation("", 0, "")
+	case StatusFail:
+		result.addObservation("", 1, "")
+	}
+	return result.finish([]byte(out)), nil
+}
+
+// A FAIL found in the output takes precedence over ABORT
+func abort(result *CheckResult) {
+	if result.Status != StatusFail {
+		result.Status = StatusAbort
+	}
+}
+
+// parseLastLine parses the last line of the output as a space separated list of values, one per device
+func parseLastLine(out []byte) ([]float64, error) {
+	output := strings.TrimSuffix(string(out[:]), "\n")
+	split := strings.Split(output, "\n")
+	values := []float64{}
+	for _, v := range strings.Split(split[len(split)-1], " ") {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			klog.Error(err.Error())
+			return nil, err
+		}
+		values = append(values, f)
+	}
+	return values, nil
 }
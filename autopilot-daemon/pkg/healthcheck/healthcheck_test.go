@@ -0,0 +1,140 @@
+package healthcheck
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IBM/autopilot/pkg/utils"
+)
+
+// fakeCheck sleeps, then passes, keeping track of how many fake checks run at the same time
+type fakeCheck struct {
+	name       HealthCheck
+	concurrent bool
+}
+
+var running, maxRunning int32
+
+func (f fakeCheck) Name() HealthCheck { return f.name }
+
+func (f fakeCheck) Run(ctx context.Context, params url.Values) (*CheckResult, error) {
+	n := atomic.AddInt32(&running, 1)
+	for {
+		max := atomic.LoadInt32(&maxRunning)
+		if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+			break
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	atomic.AddInt32(&running, -1)
+	return newCheckResult(f.name).finish([]byte(f.name)), nil
+}
+
+func (f fakeCheck) Metadata() CheckMetadata {
+	return CheckMetadata{Concurrent: f.concurrent}
+}
+
+// TestRunHealthLocalNode tests that concurrent checks run in parallel, exclusive checks one at a time,
+// and that results keep the order of the checks
+func TestRunHealthLocalNode(t *testing.T) {
+	for _, c := range []fakeCheck{{"fake-a", true}, {"fake-b", true}, {"fake-gpu-a", false}, {"fake-gpu-b", false}} {
+		Register(c)
+	}
+	t.Setenv("CHECK_CONCURRENCY", "4")
+
+	results, err := RunHealthLocalNode(context.Background(), "fake-gpu-a,fake-a,unknown,fake-gpu-b,fake-b", "1", "None", "None", nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := []HealthCheck{"fake-gpu-a", "fake-a", "unknown", "fake-gpu-b", "fake-b"}
+	for i, result := range results {
+		if result.Check != expected[i] {
+			t.Errorf("Expected %s at position %d, got %s", expected[i], i, result.Check)
+		}
+	}
+	if results[2].Status != StatusError {
+		t.Errorf("Expected %v for an unknown check, got %v", StatusError, results[2].Status)
+	}
+	// Both concurrent checks, plus one exclusive check at a time
+	if maxRunning != 3 {
+		t.Errorf("Expected 3 checks running at the same time, got %d", maxRunning)
+	}
+
+	maxRunning = 0
+	t.Setenv("CHECK_CONCURRENCY", "1")
+	RunHealthLocalNode(context.Background(), "fake-a,fake-b,fake-gpu-a", "1", "None", "None", nil)
+	if maxRunning != 1 {
+		t.Errorf("Expected checks to run one at a time, got %d", maxRunning)
+	}
+
+	// Only a whole "all" element stands for the periodic checks, not a check whose name contains it
+	Register(fakeCheck{"fake-firewall", true})
+	t.Setenv("PERIODIC_CHECKS", "fake-a,fake-b")
+	for checks, expected := range map[string]string{
+		"fake-firewall":     "fake-firewall",
+		"all,fake-firewall": "fake-a,fake-b,fake-firewall",
+	} {
+		results, _ := RunHealthLocalNode(context.Background(), checks, "1", "None", "None", nil)
+		ran := []string{}
+		for _, result := range results {
+			ran = append(ran, string(result.Check))
+		}
+		if got := strings.Join(ran, ","); got != expected {
+			t.Errorf("%s: expected %s to run, got %s", checks, expected, got)
+		}
+	}
+	if !listsCheck("fake-firewall,dcgm", DCGM) || listsCheck("dcgmx,pingall", DCGM) || listsCheck("pingall", Ping) {
+		t.Errorf("Expected checks to be matched as whole elements of the list")
+	}
+}
+
+// TestInitSettings tests that the settings read from the environment fall back to their defaults, and that invalid values are errors
+func TestInitSettings(t *testing.T) {
+	if err := InitSettings(); err != nil || GetCheckConcurrency() != 3 || GetRunRetention() != time.Hour {
+		t.Errorf("Expected the defaults, got %v, %d and %v", err, GetCheckConcurrency(), GetRunRetention())
+	}
+	t.Setenv("HISTORY_SIZE", "0")
+	t.Setenv("RUN_RETENTION", "30m")
+	if err := InitSettings(); err != nil || GetHistorySize() != 0 || GetRunRetention() != 30*time.Minute {
+		t.Errorf("Expected the settings to be read, got %v, %d and %v", err, GetHistorySize(), GetRunRetention())
+	}
+	for name, value := range map[string]string{"CHECK_CONCURRENCY": "0", "CHECK_QUEUE_SIZE": "-1", "REMOTE_RETRIES": "two", "RUN_RETENTION": "soon"} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			if err := InitSettings(); err == nil || !strings.Contains(err.Error(), name) {
+				t.Errorf("Expected an error for %s=%s, got %v", name, value, err)
+			}
+		})
+	}
+	t.Setenv("CHECK_CONCURRENCY", "0")
+	if GetCheckConcurrency() != 3 {
+		t.Errorf("Expected the default concurrency for an invalid value, got %d", GetCheckConcurrency())
+	}
+}
+
+// TestInvasiveCheckWait tests that the periodic invasive check gives up waiting for the health check lock once ctx is done
+func TestInvasiveCheckWait(t *testing.T) {
+	if _, locked := utils.HealthcheckLock.TryLock("pciebw"); !locked {
+		t.Fatal("Expected the health check lock to be free")
+	}
+	defer utils.HealthcheckLock.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		InvasiveCheck(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the invasive check to give up once ctx is done")
+	}
+	if holder, _ := utils.HealthcheckLock.Holder(); holder.Checks != "pciebw" || utils.HealthcheckLock.Waiting() != 0 {
+		t.Errorf("Expected pciebw to keep the lock without waiters, got %+v and %d waiters", holder, utils.HealthcheckLock.Waiting())
+	}
+}
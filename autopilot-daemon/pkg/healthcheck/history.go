@@ -0,0 +1,89 @@
+package healthcheck
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Longest log kept in the history for each result. Longer logs keep their end, where checks report their outcome.
+const historyLogSize = 4096
+
+// HistoryStore keeps the last results of each check in a ring buffer. It is safe for concurrent use.
+type HistoryStore struct {
+	lock    sync.RWMutex
+	size    int
+	results map[HealthCheck][]*CheckResult
+	// Position of the next result of each check, once its buffer is full
+	next map[HealthCheck]int
+}
+
+func NewHistoryStore(size int) *HistoryStore {
+	return &HistoryStore{
+		size:    size,
+		results: make(map[HealthCheck][]*CheckResult),
+		next:    make(map[HealthCheck]int),
+	}
+}
+
+// The results of the last runs of the checks of the node
+var History = NewHistoryStore(GetHistorySize())
+
+// GetHistorySize returns how many results are kept for each check, from HISTORY_SIZE. Defaults to 100
+func GetHistorySize() int {
+	size, _ := historySize()
+	return size
+}
+
+func historySize() (int, error) {
+	return envInt("HISTORY_SIZE", 100, 0)
+}
+
+// Add keeps a copy of a result, with its log trimmed, dropping the oldest result of the check if needed
+func (h *HistoryStore) Add(result *CheckResult) {
+	if h.size == 0 {
+		return
+	}
+	entry := *result
+	entry.Observations = append([]Observation(nil), result.Observations...)
+	if len(entry.Log) > historyLogSize {
+		entry.Log = "[...]" + entry.Log[len(entry.Log)-historyLogSize:]
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	results := h.results[entry.Check]
+	if len(results) < h.size {
+		h.results[entry.Check] = append(results, &entry)
+		return
+	}
+	results[h.next[entry.Check]] = &entry
+	h.next[entry.Check] = (h.next[entry.Check] + 1) % h.size
+}
+
+// List returns the results of the given checks (all if empty) started in [since, until), sorted by start time.
+// Zero times are not checked.
+func (h *HistoryStore) List(checks []HealthCheck, since time.Time, until time.Time) []CheckResult {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	if len(checks) == 0 {
+		for check := range h.results {
+			checks = append(checks, check)
+		}
+	}
+	list := []CheckResult{}
+	for _, check := range checks {
+		for _, result := range h.results[check] {
+			if (!since.IsZero() && result.Start.Before(since)) || (!until.IsZero() && !result.Start.Before(until)) {
+				continue
+			}
+			list = append(list, *result)
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Start.Equal(list[j].Start) {
+			return list[i].Check < list[j].Check
+		}
+		return list[i].Start.Before(list[j].Start)
+	})
+	return list
+}
@@ -0,0 +1,43 @@
+package healthcheck
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHistory tests that the history keeps the last results of each check, filtered by check and time range
+func TestHistory(t *testing.T) {
+	h := NewHistoryStore(3)
+	start := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		for _, check := range []HealthCheck{Ping, PCIeBW} {
+			result := newCheckResult(check)
+			result.Start = start.Add(time.Duration(i) * time.Hour)
+			result.Log = strings.Repeat("x", historyLogSize) + "SUCCESS"
+			h.Add(result)
+		}
+	}
+
+	all := h.List(nil, time.Time{}, time.Time{})
+	if len(all) != 6 {
+		t.Fatalf("Expected the last 3 results of 2 checks, got %d", len(all))
+	}
+	if !all[0].Start.Equal(start.Add(2*time.Hour)) || all[0].Check != PCIeBW || all[1].Check != Ping {
+		t.Errorf("Expected results sorted by start time and check, got %v %v first", all[0].Start, all[0].Check)
+	}
+	if !strings.HasSuffix(all[0].Log, "SUCCESS") || len(all[0].Log) > historyLogSize+5 {
+		t.Errorf("Expected the end of the log to be kept, got %d bytes", len(all[0].Log))
+	}
+
+	ping := h.List([]HealthCheck{Ping}, start.Add(3*time.Hour), start.Add(4*time.Hour))
+	if len(ping) != 1 || ping[0].Check != Ping || !ping[0].Start.Equal(start.Add(3*time.Hour)) {
+		t.Errorf("Expected the ping result started at 15:00, got %+v", ping)
+	}
+
+	disabled := NewHistoryStore(0)
+	disabled.Add(newCheckResult(Ping))
+	if len(disabled.List(nil, time.Time{}, time.Time{})) != 0 {
+		t.Errorf("Expected no history when disabled")
+	}
+}
@@ -0,0 +1,57 @@
+package healthcheck
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Per check thresholds from CHECK_FAIL_AFTER and CHECK_RECOVER_AFTER, e.g., "ping=3,pciebw=2"
+var (
+	failAfter    map[HealthCheck]int
+	recoverAfter map[HealthCheck]int
+)
+
+// InitCheckHysteresis reads how many consecutive failed runs mark a check as failed,
+// and how many consecutive successful runs mark it as recovered. Both default to 1.
+func InitCheckHysteresis() error {
+	var err error
+	failAfter, err = parseCheckCounts(os.Getenv("CHECK_FAIL_AFTER"))
+	if err != nil {
+		return fmt.Errorf("invalid CHECK_FAIL_AFTER: %w", err)
+	}
+	recoverAfter, err = parseCheckCounts(os.Getenv("CHECK_RECOVER_AFTER"))
+	if err != nil {
+		return fmt.Errorf("invalid CHECK_RECOVER_AFTER: %w", err)
+	}
+	return nil
+}
+
+func getCount(counts map[HealthCheck]int, check HealthCheck) int {
+	if n, found := counts[check]; found {
+		return n
+	}
+	return 1
+}
+
+// parseCheckCounts parses a comma separated list of check=count entries, with counts of at least 1
+func parseCheckCounts(list string) (map[HealthCheck]int, error) {
+	counts := make(map[HealthCheck]int)
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid entry %q: must be like 'check=count'", entry)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid count %q for %s: must be a positive integer", value, name)
+		}
+		counts[HealthCheck(strings.TrimSpace(name))] = n
+	}
+	return counts, nil
+}
@@ -0,0 +1,173 @@
+package healthcheck
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	autopilotv1alpha1 "github.com/IBM/autopilot/pkg/apis/autopilot/v1alpha1"
+	"github.com/IBM/autopilot/pkg/generated/clientset/versioned"
+	"github.com/IBM/autopilot/pkg/utils"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+)
+
+// The state of the checks is reported in the NodeHealth named after the node, created if missing and owned by the node,
+// so that it is deleted with it. Only the status is written, by a single goroutine, see RunNodeHealthUpdater.
+
+// Client of the NodeHealth resources, nil if the state of the checks is not reported
+var nodeHealthClient versioned.Interface
+
+// Signals that the state of the checks changed since the last update of the NodeHealth
+var nodeHealthUpdates = make(chan struct{}, 1)
+
+// Delay before the NodeHealth is updated again after a failed update, unless the state changes before
+var nodeHealthRetryDelay = time.Minute
+
+// InitNodeHealth enables the NodeHealth of the node, see RunNodeHealthUpdater
+func InitNodeHealth() error {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return err
+	}
+	nodeHealthClient, err = versioned.NewForConfig(config)
+	return err
+}
+
+// updateNodeHealth asks for an update of the NodeHealth of the node, if enabled, without waiting for it
+func updateNodeHealth() {
+	if nodeHealthClient == nil {
+		return
+	}
+	select {
+	case nodeHealthUpdates <- struct{}{}:
+	default:
+	}
+}
+
+// RunNodeHealthUpdater updates the status of the NodeHealth of the node at start, then each time the state of the checks
+// changes, until ctx is done. Failed updates are retried after nodeHealthRetryDelay. A failure is logged once, e.g.,
+// when the CRD is missing, and so is the next successful update.
+func RunNodeHealthUpdater(ctx context.Context) {
+	if nodeHealthClient == nil {
+		return
+	}
+	klog.Info("Reporting the health of node ", utils.NodeName, " in NodeHealth ", utils.NodeName)
+	failing := false
+	for {
+		var retryAfter <-chan time.Time
+		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			return syncNodeHealth(ctx, nodeHealthClient, utils.GetClientsetInstance().Cset)
+		})
+		switch {
+		case err != nil && !failing:
+			klog.Info("Cannot update NodeHealth ", utils.NodeName, ", retrying every ", nodeHealthRetryDelay, ": ", err.Error())
+			failing = true
+		case err != nil:
+			klog.V(4).Info("Cannot update NodeHealth ", utils.NodeName, ": ", err.Error())
+		case failing:
+			klog.Info("NodeHealth ", utils.NodeName, " updated")
+			failing = false
+		}
+		if err != nil {
+			retryAfter = time.After(nodeHealthRetryDelay)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-nodeHealthUpdates:
+		case <-retryAfter:
+		}
+	}
+}
+
+// syncNodeHealth writes the state of the checks to the status of the NodeHealth of the node, created if missing
+func syncNodeHealth(ctx context.Context, client versioned.Interface, cset kubernetes.Interface) error {
+	nodeHealths := client.AutopilotV1alpha1().NodeHealths()
+	nh, err := nodeHealths.Get(ctx, utils.NodeName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		node, err := cset.CoreV1().Nodes().Get(ctx, utils.NodeName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		nh = &autopilotv1alpha1.NodeHealth{ObjectMeta: metav1.ObjectMeta{
+			Name:            utils.NodeName,
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "Node", Name: node.Name, UID: node.UID}},
+		}}
+		if nh, err = nodeHealths.Create(ctx, nh, metav1.CreateOptions{}); err != nil {
+			return err
+		}
+		klog.Info("Created NodeHealth ", utils.NodeName)
+	} else if err != nil {
+		return err
+	}
+	nh.Status = nodeHealthStatus()
+	_, err = nodeHealths.UpdateStatus(ctx, nh, metav1.UpdateOptions{})
+	return err
+}
+
+// nodeHealthStatus converts the state of the checks to the status of a NodeHealth
+func nodeHealthStatus() autopilotv1alpha1.NodeHealthStatus {
+	status := autopilotv1alpha1.NodeHealthStatus{
+		Health:     "PASS",
+		GPUModel:   utils.GPUModel,
+		CPUModel:   utils.CPUModel,
+		LastUpdate: metav1.Now(),
+	}
+	if ActiveProfile != nil {
+		status.Profile = ActiveProfile.Name
+	}
+	failed := []string{}
+	for _, state := range State.List() {
+		check := autopilotv1alpha1.CheckStatus{
+			Name:          string(state.Check),
+			Status:        string(state.Status),
+			Failed:        state.Failed,
+			Failures:      int32(state.Failures),
+			Successes:     int32(state.Successes),
+			LastRun:       optionalTime(state.LastRun),
+			LastSuccess:   optionalTime(state.LastSuccess),
+			LastError:     state.LastError,
+			LastErrorTime: optionalTime(state.LastErrorTime),
+		}
+		for _, o := range state.Observations {
+			observation := autopilotv1alpha1.Observation{DeviceID: o.DeviceID, Value: formatValue(o.Value), Unit: o.Unit}
+			if o.Threshold != nil {
+				observation.Threshold = formatValue(*o.Threshold)
+			}
+			if o.MaxThreshold != nil {
+				observation.MaxThreshold = formatValue(*o.MaxThreshold)
+			}
+			check.Observations = append(check.Observations, observation)
+		}
+		if c, found := GetChecker(state.Check); state.Failed && !(found && c.Metadata().Informational) {
+			failed = append(failed, check.Name)
+		}
+		if check.LastRun != nil && (status.LastRun == nil || status.LastRun.Before(check.LastRun)) {
+			status.LastRun = check.LastRun
+		}
+		status.Checks = append(status.Checks, check)
+	}
+	if len(failed) > 0 {
+		status.Health = "WARN"
+		status.FailedChecks = strings.Join(failed, ",")
+	}
+	return status
+}
+
+func optionalTime(t time.Time) *metav1.Time {
+	if t.IsZero() {
+		return nil
+	}
+	mt := metav1.NewTime(t)
+	return &mt
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
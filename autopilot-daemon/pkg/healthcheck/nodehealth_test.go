@@ -0,0 +1,58 @@
+package healthcheck
+
+import (
+	"context"
+	"testing"
+
+	"github.com/IBM/autopilot/pkg/generated/clientset/versioned/fake"
+	"github.com/IBM/autopilot/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+// TestSyncNodeHealth tests the creation of the NodeHealth of the node, and the updates of its status
+func TestSyncNodeHealth(t *testing.T) {
+	defer func(node string, state *StateStore) { utils.NodeName, State = node, state }(utils.NodeName, State)
+	utils.NodeName = "worker-1"
+	State = NewStateStore()
+	State.Init([]HealthCheck{PCIeBW, Ping})
+	client := fake.NewSimpleClientset()
+	cset := kubefake.NewSimpleClientset(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-1", UID: "worker-1-uid"}})
+
+	if err := syncNodeHealth(context.Background(), client, cset); err != nil {
+		t.Fatal(err)
+	}
+	nh, err := client.AutopilotV1alpha1().NodeHealths().Get(context.Background(), "worker-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nh.OwnerReferences) != 1 || nh.OwnerReferences[0].UID != "worker-1-uid" {
+		t.Errorf("Expected the NodeHealth to be owned by its node, got %+v", nh.OwnerReferences)
+	}
+	if nh.Status.Health != "PASS" || len(nh.Status.Checks) != 2 || nh.Status.LastRun != nil {
+		t.Errorf("Expected 2 checks that never ran, got %+v", nh.Status)
+	}
+
+	threshold, maxThreshold := 4.0, 64.0
+	result := newCheckResult(PCIeBW)
+	result.Status = StatusFail
+	result.Observations = []Observation{{DeviceID: "0", Value: 12.5, Unit: "GB/s", Threshold: &threshold}, {DeviceID: "1", Value: 2.25, Unit: "GB/s", Threshold: &threshold, MaxThreshold: &maxThreshold}}
+	for i := 0; i < getCount(failAfter, PCIeBW); i++ {
+		State.Record(result, nil)
+	}
+	if err := syncNodeHealth(context.Background(), client, cset); err != nil {
+		t.Fatal(err)
+	}
+	nh, _ = client.AutopilotV1alpha1().NodeHealths().Get(context.Background(), "worker-1", metav1.GetOptions{})
+	if nh.Status.Health != "WARN" || nh.Status.FailedChecks != "pciebw" || nh.Status.LastRun == nil {
+		t.Errorf("Expected pciebw to fail, got %+v", nh.Status)
+	}
+	check := nh.Status.Checks[0]
+	if check.Name != "pciebw" || check.Status != "FAIL" || !check.Failed || len(check.Observations) != 2 {
+		t.Fatalf("Unexpected status of pciebw %+v", check)
+	}
+	if o := check.Observations[1]; o.DeviceID != "1" || o.Value != "2.25" || o.Unit != "GB/s" || o.Threshold != "4" || o.MaxThreshold != "64" {
+		t.Errorf("Unexpected observation %+v", o)
+	}
+}
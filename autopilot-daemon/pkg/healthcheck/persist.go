@@ -0,0 +1,125 @@
+package healthcheck
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/IBM/autopilot/pkg/utils"
+	"k8s.io/klog/v2"
+)
+
+// persistedState is the content of the state file
+type persistedState struct {
+	Node    string        `json:"node"`
+	Saved   time.Time     `json:"saved"`
+	Checks  []CheckState  `json:"checks"`
+	History []CheckResult `json:"history"`
+}
+
+var (
+	// Path of the state file, empty if the state is not persisted
+	stateFile     string
+	stateFileLock sync.Mutex
+)
+
+// InitStateFile persists the state and the history of the checks in path, usually on a hostPath volume,
+// and restores them from a previous run of the daemon on the same node, if any.
+// The gauge is set back to the last exported observations. Checks no longer registered are dropped.
+func InitStateFile(path string) error {
+	stateFile = path
+	if path == "" {
+		return nil
+	}
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		klog.Info("No state to restore from ", path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	saved := persistedState{}
+	if err := json.Unmarshal(content, &saved); err != nil {
+		return fmt.Errorf("invalid state file %s: %w", path, err)
+	}
+	if saved.Node != utils.NodeName {
+		klog.Info("State file ", path, " belongs to node ", saved.Node, ", ignoring it")
+		return nil
+	}
+	states := []CheckState{}
+	for _, state := range saved.Checks {
+		c, found := GetChecker(state.Check)
+		if !found {
+			continue
+		}
+		states = append(states, state)
+		exportObservations(c, state.Observations)
+	}
+	State.Restore(states)
+	for i := range saved.History {
+		if _, found := GetChecker(saved.History[i].Check); found {
+			History.Add(&saved.History[i])
+		}
+	}
+	klog.Info("Restored the state of ", len(states), " health checks saved at ", saved.Saved.Format(time.RFC3339), ", failed: ", GetNodeStatus())
+	return nil
+}
+
+// saveState writes the state and the history of the checks to the state file, if any.
+// The file is replaced atomically, so that a crash never leaves it half written.
+func saveState() {
+	if stateFile == "" {
+		return
+	}
+	stateFileLock.Lock()
+	defer stateFileLock.Unlock()
+	content, err := json.Marshal(persistedState{
+		Node:    utils.NodeName,
+		Saved:   time.Now(),
+		Checks:  State.List(),
+		History: History.List(nil, time.Time{}, time.Time{}),
+	})
+	if err != nil {
+		klog.Error("Cannot serialize the state: ", err.Error())
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(stateFile), ".state-*")
+	if err != nil {
+		klog.Error("Cannot save the state: ", err.Error())
+		return
+	}
+	defer os.Remove(tmp.Name())
+	// The content reaches the disk before the rename, so that a crash leaves either the old or the new state
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		klog.Error("Cannot save the state: ", err.Error())
+		return
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		klog.Error("Cannot save the state: ", err.Error())
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		klog.Error("Cannot save the state: ", err.Error())
+		return
+	}
+	if err := os.Rename(tmp.Name(), stateFile); err != nil {
+		klog.Error("Cannot save the state: ", err.Error())
+		return
+	}
+	// The rename itself is durable once the directory is synced
+	dir, err := os.Open(filepath.Dir(stateFile))
+	if err != nil {
+		klog.Error("Cannot sync the state directory: ", err.Error())
+		return
+	}
+	defer dir.Close()
+	if err := dir.Sync(); err != nil {
+		klog.Error("Cannot sync the state directory: ", err.Error())
+	}
+}
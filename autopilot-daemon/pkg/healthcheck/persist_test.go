@@ -0,0 +1,69 @@
+package healthcheck
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/IBM/autopilot/pkg/utils"
+)
+
+// TestStateFile tests that the state, the streaks and the history are restored after a restart
+func TestStateFile(t *testing.T) {
+	defer func() {
+		stateFile = ""
+		State = NewStateStore()
+		History = NewHistoryStore(GetHistorySize())
+	}()
+	path := filepath.Join(t.TempDir(), "state.json")
+	State = NewStateStore()
+	History = NewHistoryStore(10)
+	if err := InitStateFile(path); err != nil {
+		t.Fatalf("Expected no error without a state file, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		result := newCheckResult(PCIeBW)
+		result.Status = StatusFail
+		result.addObservation("0", 2.5, "GB/s")
+		State.Record(result, nil)
+		History.Add(result)
+		saveState()
+	}
+
+	// Restart
+	State = NewStateStore()
+	State.Init([]HealthCheck{PCIeBW, Ping})
+	History = NewHistoryStore(10)
+	if err := InitStateFile(path); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	state, _ := State.Get(PCIeBW)
+	if !state.Failed || state.Failures != 2 || len(state.Observations) != 1 || state.Observations[0].Value != 2.5 {
+		t.Errorf("Unexpected restored state %+v", state)
+	}
+	if !GetNodeStatus() {
+		t.Errorf("Expected the node to be restored as failed")
+	}
+	if _, found := State.Get(Ping); !found {
+		t.Errorf("Expected checks not in the state file to be kept")
+	}
+	if results := History.List(nil, time.Time{}, time.Time{}); len(results) != 2 {
+		t.Errorf("Expected 2 results in the restored history, got %d", len(results))
+	}
+
+	// A state file from another node is ignored
+	defer func(node string) { utils.NodeName = node }(utils.NodeName)
+	utils.NodeName = "another-node"
+	State = NewStateStore()
+	if err := InitStateFile(path); err != nil || GetNodeStatus() {
+		t.Errorf("Expected the state of another node to be ignored, got %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitStateFile(path); err == nil {
+		t.Errorf("Expected error for a corrupted state file")
+	}
+}
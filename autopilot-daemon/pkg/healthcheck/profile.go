@@ -0,0 +1,160 @@
+package healthcheck
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+
+	"github.com/IBM/autopilot/pkg/utils"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// ThresholdProfile holds the thresholds of the numeric checks for a class of nodes.
+// A node matches a profile if it matches all of its selectors.
+type ThresholdProfile struct {
+	Name string `json:"name"`
+	// Regular expressions matched against the GPU and CPU models of the node
+	GPUModel string `json:"gpuModel"`
+	CPUModel string `json:"cpuModel"`
+	// Label selector matched against the labels of the node (e.g., "nvidia.com/gpu.product=NVIDIA-H100-80GB-HBM3")
+	NodeSelector string `json:"nodeSelector"`
+	// Acceptable values of the observations of each check
+	Thresholds map[HealthCheck]Bounds `json:"thresholds"`
+}
+
+// Bounds of the acceptable values of an observation. A missing bound is not checked.
+type Bounds struct {
+	Min *float64 `json:"min"`
+	Max *float64 `json:"max"`
+}
+
+// The profile matching the node, if any
+var ActiveProfile *ThresholdProfile
+
+// LoadThresholdProfiles reads the profiles from a YAML file, as mounted from the threshold profiles ConfigMap,
+// and activates the first profile matching the node. The node labels are only fetched if a profile needs them.
+func LoadThresholdProfiles(path string, nodeLabels func() (map[string]string, error)) error {
+	ActiveProfile = nil
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		klog.V(2).Info("No threshold profiles loaded from ", path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var config struct {
+		Profiles []ThresholdProfile `json:"profiles"`
+	}
+	if err := yaml.UnmarshalStrict(content, &config); err != nil {
+		return fmt.Errorf("invalid threshold profiles %s: %w", path, err)
+	}
+	var nodeSet labels.Set
+	for i := range config.Profiles {
+		p := &config.Profiles[i]
+		if p.Name == "" {
+			return fmt.Errorf("threshold profile %d has no name", i)
+		}
+		if p.NodeSelector != "" && nodeSet == nil {
+			l, err := nodeLabels()
+			if err != nil {
+				return fmt.Errorf("cannot read the node labels for threshold profile %s: %w", p.Name, err)
+			}
+			nodeSet = labels.Set(l)
+		}
+		match, err := p.matches(utils.GPUModel, utils.CPUModel, nodeSet)
+		if err != nil {
+			return fmt.Errorf("invalid threshold profile %s: %w", p.Name, err)
+		}
+		if match {
+			activateProfile(p)
+			return nil
+		}
+	}
+	klog.Info("No threshold profile matches node ", utils.NodeName, ", using defaults")
+	return nil
+}
+
+func (p *ThresholdProfile) matches(gpuModel string, cpuModel string, nodeLabels labels.Set) (bool, error) {
+	for _, m := range []struct{ expr, value string }{{p.GPUModel, gpuModel}, {p.CPUModel, cpuModel}} {
+		if m.expr == "" {
+			continue
+		}
+		re, err := regexp.Compile(m.expr)
+		if err != nil {
+			return false, err
+		}
+		if !re.MatchString(m.value) {
+			return false, nil
+		}
+	}
+	if p.NodeSelector != "" {
+		selector, err := labels.Parse(p.NodeSelector)
+		if err != nil {
+			return false, err
+		}
+		if !selector.Matches(nodeLabels) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func activateProfile(p *ThresholdProfile) {
+	klog.Info("Threshold profile ", p.Name, " matches node ", utils.NodeName)
+	ActiveProfile = p
+	utils.HchecksProfile.WithLabelValues(utils.NodeName, p.Name).Set(1)
+	for check, b := range p.Thresholds {
+		if b.Min != nil {
+			utils.HchecksThreshold.WithLabelValues(string(check), utils.NodeName, p.Name, "min").Set(*b.Min)
+		}
+		if b.Max != nil {
+			utils.HchecksThreshold.WithLabelValues(string(check), utils.NodeName, p.Name, "max").Set(*b.Max)
+		}
+	}
+}
+
+// GetThresholds returns the bounds of a check in the active profile, and the name of the profile
+func GetThresholds(check HealthCheck) (Bounds, string, bool) {
+	if ActiveProfile == nil {
+		return Bounds{}, "", false
+	}
+	b, found := ActiveProfile.Thresholds[check]
+	return b, ActiveProfile.Name, found
+}
+
+// PCIeBWThreshold is the minimum bandwidth of the active profile, or the --bw flag
+func PCIeBWThreshold() float64 {
+	if b, _, found := GetThresholds(PCIeBW); found && b.Min != nil {
+		return *b.Min
+	}
+	return float64(utils.UserConfig.BWThreshold)
+}
+
+// applyThresholds fails a result with observations out of the bounds of the active profile
+func applyThresholds(result *CheckResult) {
+	b, profile, found := GetThresholds(result.Check)
+	if !found {
+		return
+	}
+	result.Profile = profile
+	result.Log = "Threshold profile: " + profile + "\n" + result.Log
+	for i := range result.Observations {
+		o := &result.Observations[i]
+		if b.Min != nil {
+			o.Threshold = b.Min
+		}
+		if b.Max != nil {
+			o.MaxThreshold = b.Max
+		}
+		if o.outOfBounds() {
+			klog.Info("Observation ", o.DeviceID, " of ", result.Check, ": ", strconv.FormatFloat(o.Value, 'f', -1, 64), " out of the bounds of profile ", profile)
+			if result.Status == StatusPass || result.Status == StatusWarn {
+				result.Status = StatusFail
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package healthcheck
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/IBM/autopilot/pkg/utils"
+)
+
+// TestThresholdProfiles tests the selection of the profile matching the node, and its thresholds
+func TestThresholdProfiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.yaml")
+	profiles := `profiles:
+  - name: h100-gen5
+    gpuModel: "H100"
+    nodeSelector: "pcie.gen=5"
+    thresholds:
+      pciebw:
+        min: 40
+  - name: a100
+    gpuModel: "A100"
+    thresholds:
+      pciebw:
+        min: 15.5
+      gpupower:
+        max: 0
+`
+	if err := os.WriteFile(path, []byte(profiles), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(gpu string) {
+		utils.GPUModel = gpu
+		ActiveProfile = nil
+	}(utils.GPUModel)
+	utils.UserConfig.BWThreshold = 4
+
+	nodeLabels := func() (map[string]string, error) {
+		return map[string]string{"pcie.gen": "5"}, nil
+	}
+	tests := []struct {
+		gpu       string
+		profile   string
+		threshold float64
+	}{
+		{"NVIDIA H100 80GB HBM3", "h100-gen5", 40},
+		{"NVIDIA A100-SXM4-80GB", "a100", 15.5},
+		{"Tesla V100-SXM2-32GB", "", 4},
+	}
+	for _, test := range tests {
+		utils.GPUModel = test.gpu
+		if err := LoadThresholdProfiles(path, nodeLabels); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		name := ""
+		if ActiveProfile != nil {
+			name = ActiveProfile.Name
+		}
+		if name != test.profile || PCIeBWThreshold() != test.threshold {
+			t.Errorf("Expected profile %q and threshold %v for %s, got %q and %v", test.profile, test.threshold, test.gpu, name, PCIeBWThreshold())
+		}
+	}
+
+	// Observations out of bounds fail the check, and the profile is reported
+	utils.GPUModel = "NVIDIA A100-SXM4-80GB"
+	LoadThresholdProfiles(path, nodeLabels)
+	result := newCheckResult(GPUPower)
+	result.addObservation("0", 0, "")
+	result.addObservation("1", 1, "")
+	applyThresholds(result)
+	if result.Status != StatusFail || result.Profile != "a100" {
+		t.Errorf("Expected %v with profile a100, got %v and %q", StatusFail, result.Status, result.Profile)
+	}
+	if o := result.Observations[1]; o.Threshold != nil || o.MaxThreshold == nil || *o.MaxThreshold != 0 {
+		t.Errorf("Expected the observations to record the maximum of the profile, got %+v", o)
+	}
+
+	if err := os.WriteFile(path, []byte("profiles:\n  - name: bad\n    gpuModel: \"(\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadThresholdProfiles(path, nodeLabels); err == nil {
+		t.Errorf("Expected error for an invalid regular expression")
+	}
+	if err := LoadThresholdProfiles(filepath.Join(t.TempDir(), "missing.yaml"), nodeLabels); err != nil || ActiveProfile != nil {
+		t.Errorf("Expected no profile and no error for a missing file, got %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package healthcheck
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// Result protocol between the check scripts and the daemon. The specification is in HEALTH_CHECKS.md.
+//
+// The daemon sets ProtocolEnv to ProtocolVersion in the environment of every check script.
+// A script that supports the protocol then writes one JSON record per line on its standard output, e.g.:
+//
+//	{"v":1,"type":"log","message":"[[ PCIEBW ]] Briefings completed"}
+//	{"v":1,"type":"observation","device":"0","value":23.9,"unit":"GB/s","threshold":4}
+//	{"v":1,"type":"status","status":"PASS"}
+//
+// Scripts that do not support it keep writing free text, which is parsed by the legacy parser of each check.
+const (
+	ProtocolEnv     = "AUTOPILOT_RESULT_PROTOCOL"
+	ProtocolVersion = 1
+)
+
+const (
+	recordLog         = "log"
+	recordObservation = "observation"
+	recordStatus      = "status"
+)
+
+type protocolRecord struct {
+	Version   int         `json:"v"`
+	Type      string      `json:"type"`
+	Message   string      `json:"message,omitempty"`
+	Device    string      `json:"device,omitempty"`
+	Value     *float64    `json:"value,omitempty"`
+	Unit      string      `json:"unit,omitempty"`
+	Threshold *float64    `json:"threshold,omitempty"`
+	Status    CheckStatus `json:"status,omitempty"`
+}
+
+// parseOutput parses the output of a check script with the result protocol if the script speaks it,
+// otherwise with the legacy parser of the check, which receives standard error followed by standard output.
+func parseOutput(result *CheckResult, stdout []byte, stderr []byte, legacy func(*CheckResult, []byte) (*CheckResult, error)) (*CheckResult, error) {
+	if isProtocolOutput(stdout) {
+		return parseProtocol(result, stdout, stderr)
+	}
+	return legacy(result, append(stderr, stdout...))
+}
+
+// The output speaks the protocol if its first non empty line is a versioned record
+func isProtocolOutput(stdout []byte) bool {
+	for _, line := range bytes.Split(stdout, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var header struct {
+			Version *int `json:"v"`
+		}
+		if line[0] != '{' || json.Unmarshal(line, &header) != nil {
+			return false
+		}
+		return header.Version != nil
+	}
+	return false
+}
+
+// parseProtocol strictly parses the protocol records. Any malformed or unexpected record, or a
+// missing status record, makes the result an ERROR. Standard error is appended to the log as is.
+func parseProtocol(result *CheckResult, stdout []byte, stderr []byte) (*CheckResult, error) {
+	logs := []string{}
+	defer func() {
+		if len(stderr) > 0 {
+			logs = append(logs, strings.TrimSuffix(string(stderr), "\n"))
+		}
+		result.finish([]byte(strings.Join(logs, "\n") + "\n"))
+	}()
+	var status CheckStatus
+	scanner := bufio.NewScanner(bytes.NewReader(stdout))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		rec, err := decodeRecord(line)
+		if err != nil {
+			return protocolError(result, lineno, err)
+		}
+		switch rec.Type {
+		case recordLog:
+			logs = append(logs, rec.Message)
+		case recordObservation:
+			if rec.Value == nil {
+				return protocolError(result, lineno, fmt.Errorf("observation without value"))
+			}
+			result.Observations = append(result.Observations, Observation{
+				DeviceID:  rec.Device,
+				Value:     *rec.Value,
+				Unit:      rec.Unit,
+				Threshold: rec.Threshold,
+			})
+		case recordStatus:
+			if status != "" {
+				return protocolError(result, lineno, fmt.Errorf("duplicate status record"))
+			}
+			switch rec.Status {
+			case StatusPass, StatusWarn, StatusFail, StatusAbort, StatusError:
+			default:
+				return protocolError(result, lineno, fmt.Errorf("unknown status %q", rec.Status))
+			}
+			status = rec.Status
+			if rec.Message != "" {
+				logs = append(logs, rec.Message)
+			}
+		default:
+			return protocolError(result, lineno, fmt.Errorf("unknown record type %q", rec.Type))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return protocolError(result, lineno, err)
+	}
+	if status == "" {
+		return protocolError(result, lineno, fmt.Errorf("missing status record"))
+	}
+	result.Status = status
+	// An observation below its threshold fails the check, whatever the script reported
+	for _, o := range result.Observations {
+		if o.Threshold != nil && o.Value < *o.Threshold && (status == StatusPass || status == StatusWarn) {
+			klog.Info("Device ", o.DeviceID, " below expected threshold of ", *o.Threshold, " ", o.Unit)
+			result.Status = StatusFail
+		}
+	}
+	return result, nil
+}
+
+func decodeRecord(line []byte) (*protocolRecord, error) {
+	rec := &protocolRecord{}
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(rec); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("trailing data after record")
+	}
+	if rec.Version != ProtocolVersion {
+		return nil, fmt.Errorf("unsupported protocol version %d", rec.Version)
+	}
+	return rec, nil
+}
+
+func protocolError(result *CheckResult, lineno int, err error) (*CheckResult, error) {
+	result.Status = StatusError
+	result.Observations = nil
+	return result, fmt.Errorf("result protocol error at line %d: %w", lineno, err)
+}
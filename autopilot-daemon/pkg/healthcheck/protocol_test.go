@@ -0,0 +1,67 @@
+package healthcheck
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestParseProtocol tests the strict parsing of the result protocol records
+func TestParseProtocol(t *testing.T) {
+	valid := `{"v":1,"type":"log","message":"[[ PCIEBW ]] Briefings completed"}
+{"v":1,"type":"observation","device":"0","value":23.9,"unit":"GB/s","threshold":4}
+{"v":1,"type":"observation","device":"1","value":24.1,"unit":"GB/s","threshold":4}
+{"v":1,"type":"status","status":"PASS","message":"[[ PCIEBW ]] SUCCESS"}
+`
+	if !isProtocolOutput([]byte(valid)) {
+		t.Fatalf("Expected protocol output to be detected")
+	}
+	result, err := parseProtocol(newCheckResult(PCIeBW), []byte(valid), []byte("a warning\n"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.Status != StatusPass {
+		t.Errorf("Expected status %v, got %v", StatusPass, result.Status)
+	}
+	if len(result.Observations) != 2 || result.Observations[1].DeviceID != "1" || result.Observations[1].Value != 24.1 {
+		t.Errorf("Unexpected observations %+v", result.Observations)
+	}
+	if !strings.Contains(result.Log, "Briefings completed") || !strings.Contains(result.Log, "a warning") {
+		t.Errorf("Expected log and stderr in the result log, got %q", result.Log)
+	}
+
+	// An observation below threshold fails the check even if the script says otherwise
+	below := `{"v":1,"type":"observation","device":"0","value":2,"threshold":4}
+{"v":1,"type":"status","status":"PASS"}`
+	result, err = parseProtocol(newCheckResult(PCIeBW), []byte(below), nil)
+	if err != nil || result.Status != StatusFail {
+		t.Errorf("Expected %v with no error, got %v and %v", StatusFail, result.Status, err)
+	}
+
+	invalid := map[string]string{
+		"missing status":   `{"v":1,"type":"log","message":"hello"}`,
+		"duplicate status": "{\"v\":1,\"type\":\"status\",\"status\":\"PASS\"}\n{\"v\":1,\"type\":\"status\",\"status\":\"FAIL\"}",
+		"unknown status":   `{"v":1,"type":"status","status":"MAYBE"}`,
+		"unknown type":     `{"v":1,"type":"metric","status":"PASS"}`,
+		"unknown field":    `{"v":1,"type":"status","status":"PASS","extra":1}`,
+		"wrong version":    `{"v":2,"type":"status","status":"PASS"}`,
+		"missing value":    "{\"v\":1,\"type\":\"observation\",\"device\":\"0\"}\n{\"v\":1,\"type\":\"status\",\"status\":\"PASS\"}",
+		"free text":        "{\"v\":1,\"type\":\"log\",\"message\":\"hello\"}\nSUCCESS\n{\"v\":1,\"type\":\"status\",\"status\":\"PASS\"}",
+	}
+	for name, out := range invalid {
+		result, err := parseProtocol(newCheckResult(PCIeBW), []byte(out), nil)
+		if err == nil {
+			t.Errorf("Expected error for %s, got nil", name)
+		}
+		if result.Status != StatusError {
+			t.Errorf("Expected status %v for %s, got %v", StatusError, name, result.Status)
+		}
+	}
+
+	// Legacy output is not mistaken for protocol output
+	legacy := []string{"SUCCESS\nHost  node1\n23.9 24.1\n", "", "{not json}\n", `{"type":"status"}`}
+	for _, out := range legacy {
+		if isProtocolOutput([]byte(out)) {
+			t.Errorf("Expected %q not to be detected as protocol output", out)
+		}
+	}
+}
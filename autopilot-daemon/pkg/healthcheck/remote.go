@@ -0,0 +1,506 @@
+package healthcheck
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IBM/autopilot/pkg/utils"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// Service of the Autopilot pods, whose EndpointSlices locate the pod of each node
+	remoteService = "autopilot-healthchecks"
+	// Port of the health checks, if the EndpointSlices do not name it
+	remotePortName    = "healthcheck"
+	remoteDefaultPort = 3333
+	// Token authenticating the daemon to the other Autopilot pods, when they require it
+	serviceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+)
+
+// Delay before retrying a node, multiplied by the number of attempts so far
+var remoteRetryDelay = 5 * time.Second
+
+// The client calling the other Autopilot pods, see InitRemoteClient
+var (
+	remoteClient = &http.Client{}
+	remoteScheme = "http"
+)
+
+// InitRemoteClient makes the calls to the other Autopilot pods use TLS, presenting the certificate of the daemon and
+// verifying theirs for serverName. Plain HTTP is used if tlsFiles is nil.
+func InitRemoteClient(tlsFiles *utils.TLSFiles, serverName string) {
+	if tlsFiles == nil {
+		return
+	}
+	remoteScheme = "https"
+	remoteClient = &http.Client{Transport: &http.Transport{TLSClientConfig: tlsFiles.ClientConfig(serverName)}}
+}
+
+// GetRemoteRetries returns how many times a node is retried when its Autopilot pod cannot be reached or is busy,
+// from REMOTE_RETRIES. Defaults to 2
+func GetRemoteRetries() int {
+	retries, _ := remoteRetries()
+	return retries
+}
+
+func remoteRetries() (int, error) {
+	return envInt("REMOTE_RETRIES", 2, 0)
+}
+
+// NodeSelector selects the nodes of a remote run. A node is selected if it matches any of the fields.
+type NodeSelector struct {
+	// Node names. "all" selects all the nodes running Autopilot, unless NodeLabel or Workload is set.
+	Nodes []string
+	// Label selector of the nodes
+	NodeLabel string
+	// Nodes running the pods of a workload, as namespace:label-selector
+	Workload string
+}
+
+// RemoteRun is a run of health checks by the Autopilot pods of other nodes
+type RemoteRun struct {
+	Selector NodeSelector
+	// Comma separated checks, or "all"
+	Checks string
+	// Parameters of the checks, e.g., "r" for dcgm
+	Params url.Values
+	// How many nodes run the checks at the same time, all of them if 0
+	Batch int
+	// How many times a node is retried when its pod cannot be reached or is busy
+	Retries int
+}
+
+// NodeResult is the outcome of a remote run on one node
+type NodeResult struct {
+	Node string `json:"node"`
+	// Address of the Autopilot pod of the node
+	Address  string         `json:"address,omitempty"`
+	Attempts int            `json:"attempts"`
+	Results  []*CheckResult `json:"results,omitempty"`
+	// Whether any check counts against the node health
+	Failed bool `json:"failed"`
+	// The checks could not run on the node: its pod could not be reached, or did not answer the request
+	Error string `json:"error,omitempty"`
+	// Error reported by the pod at the end of the run, e.g., when some checks could not run. Results are kept
+	RunError string `json:"runError,omitempty"`
+}
+
+// RunHealthRemoteNodes asks the Autopilot pods of the selected nodes to run the checks, with the parameters of /status.
+// The run stops when ctx is done. If ctx has an output hook, the output of the remote checks is passed to it
+// line by line, tagged with their node. See RunRemote.
+func RunHealthRemoteNodes(ctx context.Context, host string, check string, batch string, jobName string, dcgmR string, nodelabel string) (map[string]*NodeResult, error) {
+	run := RemoteRun{
+		Selector: NodeSelector{Nodes: strings.Split(host, ",")},
+		Checks:   check,
+		Params:   url.Values{},
+		Retries:  GetRemoteRetries(),
+	}
+	run.Batch, _ = strconv.Atoi(batch)
+	if nodelabel != "None" {
+		run.Selector.NodeLabel = nodelabel
+	}
+	if jobName != "None" {
+		run.Selector.Workload = jobName
+	}
+	if listsCheck(check, "all") || listsCheck(check, DCGM) {
+		run.Params.Set("r", dcgmR)
+	}
+	// Ping checks the nodes of the run
+	if listsCheck(check, Ping) {
+		if jobName != "None" {
+			run.Params.Set("job", jobName)
+		}
+		if nodelabel != "None" {
+			run.Params.Set("nodelabel", nodelabel)
+		}
+		if host != "all" {
+			run.Params.Set("pingnodes", host)
+		}
+	}
+	klog.Info("Running ", check, " on remote nodes ", host, ", node label ", nodelabel, ", workload ", jobName)
+	return RunRemote(ctx, utils.GetClientsetInstance().Cset, run)
+}
+
+type nodeHookKey struct{}
+
+type nodeHook struct {
+	selected func(nodes []string)
+	done     func(result *NodeResult)
+}
+
+// WithNodeHook returns a context under which RunRemote passes the selected nodes to selected, before running the checks,
+// then the outcome of each node to done as soon as the node completes, e.g., to track the progress of a run
+func WithNodeHook(ctx context.Context, selected func(nodes []string), done func(result *NodeResult)) context.Context {
+	return context.WithValue(ctx, nodeHookKey{}, nodeHook{selected: selected, done: done})
+}
+
+// RunRemote runs checks on the Autopilot pods of the selected nodes, found through the EndpointSlices of their service,
+// and returns the outcome on each node. At most run.Batch nodes run at the same time. Each node waits for the checks
+// already running on it, and is retried if its pod cannot be reached or its queue is full. Failing checks are not
+// errors: the returned error tells that the nodes could not be selected, or that some of them could not run the checks.
+// See WithNodeHook to follow the nodes as they complete.
+func RunRemote(ctx context.Context, cset kubernetes.Interface, run RemoteRun) (map[string]*NodeResult, error) {
+	nodes, err := selectNodes(ctx, cset, run.Selector)
+	if err != nil {
+		return nil, err
+	}
+	addresses, err := remoteAddresses(ctx, cset)
+	if err != nil {
+		return nil, err
+	}
+	if nodes == nil {
+		nodes = []string{}
+		for node := range addresses {
+			nodes = append(nodes, node)
+		}
+		sort.Strings(nodes)
+	}
+	if len(nodes) == 0 {
+		return nil, errors.New("no node to run the health checks on")
+	}
+	hook, _ := ctx.Value(nodeHookKey{}).(nodeHook)
+	if hook.selected != nil {
+		hook.selected(nodes)
+	}
+
+	batch := run.Batch
+	if batch <= 0 || batch > len(nodes) {
+		batch = len(nodes)
+	}
+	results := make(map[string]*NodeResult, len(nodes))
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	pool := make(chan struct{}, batch)
+	for _, node := range nodes {
+		wg.Add(1)
+		go func(node string) {
+			defer wg.Done()
+			pool <- struct{}{}
+			defer func() { <-pool }()
+			var result *NodeResult
+			if address, found := addresses[node]; found {
+				result = run.runNode(ctx, node, address)
+			} else {
+				result = &NodeResult{Node: node, Error: "no ready Autopilot pod on the node"}
+			}
+			if hook.done != nil {
+				hook.done(result)
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			results[node] = result
+		}(node)
+	}
+	wg.Wait()
+
+	failed := []string{}
+	for _, node := range nodes {
+		if results[node].Error != "" {
+			failed = append(failed, node)
+		}
+	}
+	if len(failed) > 0 {
+		return results, fmt.Errorf("health checks could not run on nodes %s", strings.Join(failed, ", "))
+	}
+	return results, nil
+}
+
+// selectNodes returns the names of the selected nodes, sorted, or nil for all the nodes running Autopilot
+func selectNodes(ctx context.Context, cset kubernetes.Interface, sel NodeSelector) ([]string, error) {
+	selected := make(map[string]bool)
+	all := false
+	for _, node := range sel.Nodes {
+		switch node {
+		case "":
+		case "all":
+			all = sel.NodeLabel == "" && sel.Workload == ""
+		default:
+			selected[node] = true
+		}
+	}
+	if all {
+		return nil, nil
+	}
+	if sel.NodeLabel != "" {
+		labeled, err := cset.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: sel.NodeLabel})
+		if err != nil {
+			return nil, err
+		}
+		if len(labeled.Items) == 0 {
+			return nil, errors.New("no node is labeled with " + sel.NodeLabel)
+		}
+		for _, node := range labeled.Items {
+			selected[node.Name] = true
+		}
+	}
+	if sel.Workload != "" {
+		namespace, selector, found := strings.Cut(sel.Workload, ":")
+		if !found || namespace == "" || selector == "" {
+			return nil, errors.New("invalid workload " + sel.Workload + ", must be namespace:label-key=label-value")
+		}
+		pods, err := cset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return nil, err
+		}
+		scheduled := 0
+		for _, pod := range pods.Items {
+			if pod.Spec.NodeName != "" {
+				selected[pod.Spec.NodeName] = true
+				scheduled++
+			}
+		}
+		if scheduled == 0 {
+			return nil, errors.New("no pod of workload " + sel.Workload + " is scheduled on a node")
+		}
+	}
+	nodes := make([]string, 0, len(selected))
+	for node := range selected {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes, nil
+}
+
+// remoteAddresses returns the address of the ready Autopilot pod of each node, as host:port
+func remoteAddresses(ctx context.Context, cset kubernetes.Interface) (map[string]string, error) {
+	slices, err := cset.DiscoveryV1().EndpointSlices(utils.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: discoveryv1.LabelServiceName + "=" + remoteService,
+	})
+	if err != nil {
+		return nil, err
+	}
+	addresses := make(map[string]string)
+	for _, slice := range slices.Items {
+		port := remoteDefaultPort
+		for _, p := range slice.Ports {
+			if p.Port != nil && (p.Name == nil || *p.Name == remotePortName) {
+				port = int(*p.Port)
+			}
+		}
+		for _, endpoint := range slice.Endpoints {
+			if endpoint.NodeName == nil || len(endpoint.Addresses) == 0 {
+				continue
+			}
+			if endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready {
+				continue
+			}
+			addresses[*endpoint.NodeName] = net.JoinHostPort(endpoint.Addresses[0], strconv.Itoa(port))
+		}
+	}
+	return addresses, nil
+}
+
+// runNode runs the checks on the pod of a node, retrying as needed
+func (r RemoteRun) runNode(ctx context.Context, node string, address string) *NodeResult {
+	result := &NodeResult{Node: node, Address: address}
+	for {
+		result.Attempts++
+		retry, err := r.call(ctx, node, address, result)
+		if err == nil {
+			break
+		}
+		if !retry || result.Attempts > r.Retries || ctx.Err() != nil {
+			klog.Info("Health checks failed to run on node ", node, ": ", err.Error())
+			result.Error = err.Error()
+			break
+		}
+		klog.Info("Health checks failed to run on node ", node, ", retrying: ", err.Error())
+		timer := time.NewTimer(remoteRetryDelay * time.Duration(result.Attempts))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+	for _, check := range result.Results {
+		if check.Status == StatusPass || check.Status == StatusWarn {
+			continue
+		}
+		if c, found := GetChecker(check.Check); found && c.Metadata().Informational {
+			continue
+		}
+		result.Failed = true
+	}
+	return result
+}
+
+// call runs the checks on the pod of a node, reading its output and results as Server-Sent Events.
+// Returns whether the call can be retried if it failed, i.e., if the checks did not start.
+func (r RemoteRun) call(ctx context.Context, node string, address string, result *NodeResult) (bool, error) {
+	params := url.Values{}
+	for key, values := range r.Params {
+		params[key] = values
+	}
+	params.Set("host", node)
+	if r.Checks != "all" {
+		params.Set("check", r.Checks)
+	}
+	params.Set("wait", "")
+	params.Set("stream", "sse")
+	target := remoteScheme + "://" + address + "/status?" + params.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if token, err := os.ReadFile(serviceAccountTokenFile); err == nil {
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	klog.Info("Running health checks on node ", node, ": ", target)
+	resp, err := remoteClient.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusBadGateway
+		return retry, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	hook, _ := ctx.Value(outputHookKey{}).(func(OutputLine))
+	done := false
+	err = readEvents(resp.Body, func(event string, data []byte) error {
+		switch event {
+		case "output":
+			if hook == nil {
+				return nil
+			}
+			var line OutputLine
+			if err := json.Unmarshal(data, &line); err != nil {
+				return err
+			}
+			hook(line)
+		case "result":
+			var check CheckResult
+			if err := json.Unmarshal(data, &check); err != nil {
+				return err
+			}
+			result.Results = append(result.Results, &check)
+		case "done":
+			var end struct {
+				Error string `json:"error"`
+			}
+			if err := json.Unmarshal(data, &end); err != nil {
+				return err
+			}
+			done = true
+			if end.Error != "" {
+				klog.Info("Health checks on node ", node, " ended with an error: ", end.Error)
+				result.RunError = end.Error
+			}
+		}
+		return nil
+	})
+	switch {
+	case err != nil:
+		return false, err
+	case !done:
+		return false, errors.New("connection closed before the end of the run")
+	}
+	return false, nil
+}
+
+// readEvents passes the Server-Sent Events read from r to fn, until r ends or fn fails
+func readEvents(r io.Reader, fn func(event string, data []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	// Results carry the output of their check
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	event, data := "", []byte{}
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if len(data) > 0 {
+				if err := fn(event, data); err != nil {
+					return err
+				}
+			}
+			event, data = "", []byte{}
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			if len(data) > 0 {
+				data = append(data, '\n')
+			}
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")...)
+		}
+	}
+	return scanner.Err()
+}
+
+// FormatNodeResults describes the outcome of a remote run as plain text: the output of the checks on each node,
+// then a summary of the status of each node
+func FormatNodeResults(results map[string]*NodeResult) []byte {
+	nodes := make([]string, 0, len(results))
+	for node := range results {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	var b strings.Builder
+	for _, node := range nodes {
+		result := results[node]
+		fmt.Fprintf(&b, "\nAutopilot Endpoint: %s\nNode: %s\nResponse:\n", result.Address, node)
+		for _, check := range result.Results {
+			b.WriteString(check.Log)
+			if !strings.HasSuffix(check.Log, "\n") {
+				b.WriteString("\n")
+			}
+		}
+		fmt.Fprintf(&b, "Node Status: %s\n-------------------------------------\n", nodeStatus(result))
+	}
+	b.Write(FormatNodeSummary(results))
+	return []byte(b.String())
+}
+
+// FormatNodeSummary describes the status of each node of a remote run as plain text
+func FormatNodeSummary(results map[string]*NodeResult) []byte {
+	nodes := make([]string, 0, len(results))
+	for node := range results {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	var b strings.Builder
+	b.WriteString("\nNode Summary:\n")
+	for _, node := range nodes {
+		fmt.Fprintf(&b, "%s: %s\n", node, nodeStatus(results[node]))
+	}
+	return []byte(b.String())
+}
+
+// nodeStatus lists the checks that did not pass on a node and the error of the run, if any, or returns OK
+func nodeStatus(result *NodeResult) string {
+	status := []string{}
+	for _, check := range result.Results {
+		if check.Status != StatusPass {
+			status = append(status, string(check.Check)+" "+string(check.Status))
+		}
+	}
+	if result.RunError != "" {
+		status = append(status, "ERROR: "+result.RunError)
+	}
+	if result.Error != "" {
+		status = append(status, "ABORT: "+result.Error)
+	}
+	if len(status) == 0 {
+		return "OK"
+	}
+	return strings.Join(status, ", ")
+}
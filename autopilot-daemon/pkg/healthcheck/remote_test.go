@@ -0,0 +1,155 @@
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// remotePod serves /status as an Autopilot pod streaming Server-Sent Events. It answers 429 busy times first,
+// and ends the run with runErr if set.
+type remotePod struct {
+	node   string
+	status CheckStatus
+	busy   int
+	runErr string
+	lock   sync.Mutex
+	calls  int
+	server *httptest.Server
+}
+
+func (p *remotePod) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.lock.Lock()
+	p.calls++
+	busy := p.calls <= p.busy
+	p.lock.Unlock()
+	if busy {
+		http.Error(w, "too many health check runs waiting", http.StatusTooManyRequests)
+		return
+	}
+	if r.URL.Query().Get("host") != p.node || !r.URL.Query().Has("wait") {
+		http.Error(w, "unexpected query "+r.URL.RawQuery, http.StatusBadRequest)
+		return
+	}
+	time.Sleep(20 * time.Millisecond)
+	w.Header().Set("Content-Type", "text/event-stream")
+	fmt.Fprintf(w, "event: output\ndata: {\"node\":%q,\"check\":\"fake-remote\",\"stream\":\"stdout\",\"line\":\"running\"}\n\n", p.node)
+	fmt.Fprintf(w, "event: result\ndata: {\"check\":\"fake-remote\",\"status\":%q,\"log\":\"log of %s\\n\"}\n\n", p.status, p.node)
+	fmt.Fprintf(w, "event: done\ndata: {\"node\":%q,\"error\":%q}\n\n", p.node, p.runErr)
+}
+
+// endpointSlice exposes the pod of a node, as the EndpointSlice controller does
+func (p *remotePod) endpointSlice(t *testing.T) *discoveryv1.EndpointSlice {
+	host, port, err := net.SplitHostPort(strings.TrimPrefix(p.server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	portNumber, _ := strconv.Atoi(port)
+	name, protocol, number, ready := remotePortName, corev1.ProtocolTCP, int32(portNumber), true
+	return &discoveryv1.EndpointSlice{
+		ObjectMeta:  metav1.ObjectMeta{Name: remoteService + "-" + p.node, Labels: map[string]string{discoveryv1.LabelServiceName: remoteService}},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints:   []discoveryv1.Endpoint{{Addresses: []string{host}, NodeName: &p.node, Conditions: discoveryv1.EndpointConditions{Ready: &ready}}},
+		Ports:       []discoveryv1.EndpointPort{{Name: &name, Protocol: &protocol, Port: &number}},
+	}
+}
+
+// TestRunRemote tests the selection of the nodes, the bounded fan-out, the retries and the results of each node
+func TestRunRemote(t *testing.T) {
+	Register(fakeCheck{"fake-remote", true})
+	defer func(delay time.Duration) { remoteRetryDelay = delay }(remoteRetryDelay)
+	remoteRetryDelay = time.Millisecond
+
+	pods := []*remotePod{{node: "node-1", status: StatusPass}, {node: "node-2", status: StatusFail, busy: 1}, {node: "node-3", status: StatusPass}}
+	objects := []runtime.Object{
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{"gpu": "a100"}}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-2", Labels: map[string]string{"gpu": "h100"}}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-3", Labels: map[string]string{"gpu": "a100"}}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "trainer", Namespace: "default", Labels: map[string]string{"app": "trainer"}}, Spec: corev1.PodSpec{NodeName: "node-2"}},
+	}
+	for _, pod := range pods {
+		pod.server = httptest.NewServer(pod)
+		defer pod.server.Close()
+		objects = append(objects, pod.endpointSlice(t))
+	}
+	cset := fake.NewSimpleClientset(objects...)
+
+	var lock sync.Mutex
+	lines := []OutputLine{}
+	ctx := WithOutputHook(context.Background(), func(line OutputLine) {
+		lock.Lock()
+		defer lock.Unlock()
+		lines = append(lines, line)
+	})
+	results, err := RunRemote(ctx, cset, RemoteRun{Selector: NodeSelector{Nodes: []string{"all"}}, Checks: "fake-remote", Batch: 2, Retries: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || len(lines) != 3 {
+		t.Fatalf("Expected the results and the output of 3 nodes, got %+v and %+v", results, lines)
+	}
+	if r := results["node-1"]; r.Failed || r.Attempts != 1 || len(r.Results) != 1 || r.Results[0].Log != "log of node-1\n" {
+		t.Errorf("Expected node-1 to pass at once, got %+v", r)
+	}
+	if r := results["node-2"]; !r.Failed || r.Attempts != 2 || r.Error != "" {
+		t.Errorf("Expected node-2 to fail after a retry, got %+v", r)
+	}
+	if summary := string(FormatNodeSummary(results)); !strings.Contains(summary, "node-2: fake-remote FAIL") || !strings.Contains(summary, "node-3: OK") {
+		t.Errorf("Unexpected summary %s", summary)
+	}
+
+	// Runs follow the selected nodes as they complete
+	s := NewRunStore(time.Hour)
+	run := s.Start("fake-remote", "all", 0, func(ctx context.Context, run *Run) error {
+		_, err := RunRemote(ctx, cset, RemoteRun{Selector: NodeSelector{Nodes: []string{"all"}}, Checks: "fake-remote", Batch: 1, Retries: 1})
+		return err
+	})
+	if run = waitRun(t, s, run.ID); run.State != RunCompleted || run.Total != 3 || run.Completed != 3 || len(run.Nodes) != 3 || !run.Nodes["node-2"].Failed {
+		t.Errorf("Expected the outcome of 3 nodes, got %+v", run)
+	}
+
+	// An error at the end of the run keeps the results of the node
+	pods[0].runErr = "health check dcgm could not run"
+	results, err = RunRemote(ctx, cset, RemoteRun{Selector: NodeSelector{Nodes: []string{"node-1"}}, Checks: "fake-remote"})
+	pods[0].runErr = ""
+	if r := results["node-1"]; err != nil || r.Error != "" || r.RunError != "health check dcgm could not run" || len(r.Results) != 1 {
+		t.Errorf("Expected the results of node-1 and its run error, got %+v with %v", r, err)
+	}
+
+	// Without retries, the busy node cannot run the checks
+	pods[1].calls = 0
+	results, err = RunRemote(ctx, cset, RemoteRun{Selector: NodeSelector{NodeLabel: "gpu=h100"}, Checks: "fake-remote"})
+	if err == nil || len(results) != 1 || !strings.Contains(results["node-2"].Error, "429") {
+		t.Errorf("Expected node-2 to be busy, got %+v with %v", results, err)
+	}
+
+	// Nodes, label and workload select the union of their nodes
+	nodes, err := selectNodes(context.Background(), cset, NodeSelector{Nodes: []string{"all"}, NodeLabel: "gpu=a100", Workload: "default:app=trainer"})
+	if err != nil || strings.Join(nodes, ",") != "node-1,node-2,node-3" {
+		t.Errorf("Expected the 3 nodes, got %v with %v", nodes, err)
+	}
+	nodes, err = selectNodes(context.Background(), cset, NodeSelector{Nodes: []string{"node-4"}, Workload: "default:app=trainer"})
+	if err != nil || strings.Join(nodes, ",") != "node-2,node-4" {
+		t.Errorf("Expected node-2 and node-4, got %v with %v", nodes, err)
+	}
+	if _, err := selectNodes(context.Background(), cset, NodeSelector{NodeLabel: "gpu=v100"}); err == nil {
+		t.Errorf("Expected an error without labeled node")
+	}
+	results, err = RunRemote(context.Background(), cset, RemoteRun{Selector: NodeSelector{Nodes: []string{"node-4"}}, Checks: "fake-remote"})
+	if err == nil || results["node-4"].Error == "" {
+		t.Errorf("Expected an error for a node without Autopilot pod, got %+v with %v", results, err)
+	}
+}
@@ -0,0 +1,203 @@
+package healthcheck
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Status of a node in a Report
+const (
+	NodeOK = "OK"
+	// Some checks did not pass, none of them counts against the node health
+	NodeWarn = "WARN"
+	// Some checks count against the node health
+	NodeFail = "FAIL"
+	// The checks could not run on the node, e.g., its Autopilot pod is unreachable
+	NodeUnreachable = "UNREACHABLE"
+)
+
+// Report aggregates the outcome of a remote run on every node of the cluster
+type Report struct {
+	Generated time.Time `json:"generated"`
+	// Checks of the run, as requested
+	Checks string       `json:"checks"`
+	Totals ReportTotals `json:"totals"`
+	// Nodes sorted by name
+	Nodes []NodeReport `json:"nodes"`
+}
+
+// ReportTotals counts the nodes of a Report by status, and the failing checks and devices
+type ReportTotals struct {
+	Nodes       int `json:"nodes"`
+	OK          int `json:"ok"`
+	Warn        int `json:"warn"`
+	Failed      int `json:"failed"`
+	Unreachable int `json:"unreachable"`
+	// Offending devices, over all the nodes
+	Devices int `json:"devices"`
+	// Number of nodes on which each check did not pass
+	Checks map[HealthCheck]int `json:"checks"`
+}
+
+// NodeReport is the status of a node, with the checks that did not pass on it
+type NodeReport struct {
+	Node   string `json:"node"`
+	Status string `json:"status"`
+	// Checks that did not pass, in the order they ran
+	Checks []CheckReport `json:"checks,omitempty"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// CheckReport is a check that did not pass on a node, with the observations of its offending devices
+type CheckReport struct {
+	Check   HealthCheck   `json:"check"`
+	Status  CheckStatus   `json:"status"`
+	Devices []Observation `json:"devices,omitempty"`
+}
+
+// NewReport aggregates the results of a remote run, see RunRemote
+func NewReport(checks string, results map[string]*NodeResult) *Report {
+	report := &Report{
+		Generated: time.Now(),
+		Checks:    checks,
+		Totals:    ReportTotals{Checks: map[HealthCheck]int{}},
+		Nodes:     []NodeReport{},
+	}
+	nodes := make([]string, 0, len(results))
+	for node := range results {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	for _, node := range nodes {
+		n := newNodeReport(results[node])
+		report.Nodes = append(report.Nodes, n)
+		report.Totals.Nodes++
+		switch n.Status {
+		case NodeOK:
+			report.Totals.OK++
+		case NodeWarn:
+			report.Totals.Warn++
+		case NodeFail:
+			report.Totals.Failed++
+		case NodeUnreachable:
+			report.Totals.Unreachable++
+		}
+		for _, c := range n.Checks {
+			report.Totals.Checks[c.Check]++
+			report.Totals.Devices += len(c.Devices)
+		}
+	}
+	return report
+}
+
+func newNodeReport(result *NodeResult) NodeReport {
+	n := NodeReport{Node: result.Node, Status: NodeOK, Error: result.Error}
+	if n.Error == "" {
+		n.Error = result.RunError
+	}
+	for _, check := range result.Results {
+		if check.Status == StatusPass {
+			continue
+		}
+		n.Checks = append(n.Checks, CheckReport{Check: check.Check, Status: check.Status, Devices: offendingDevices(check)})
+		n.Status = NodeWarn
+	}
+	switch {
+	case result.Error != "" && len(result.Results) == 0:
+		n.Status = NodeUnreachable
+	case result.Failed:
+		n.Status = NodeFail
+	case result.Error != "" || result.RunError != "":
+		n.Status = NodeWarn
+	}
+	return n
+}
+
+// offendingDevices returns the observations of a failed check that are out of their bounds or, without bounds,
+// that are not 0, as the checks report 1 for a device with errors (e.g., remapped rows, unreachable node for ping).
+func offendingDevices(result *CheckResult) []Observation {
+	if !result.Failed() {
+		return nil
+	}
+	devices := []Observation{}
+	for _, o := range result.Observations {
+		if o.outOfBounds() || (!o.hasBounds() && o.Value != 0) {
+			devices = append(devices, o)
+		}
+	}
+	return devices
+}
+
+var reportColumns = []string{"node", "status", "check", "check_status", "device", "value", "unit", "threshold", "max_threshold", "error"}
+
+// rows flattens the report to one row per offending device, per check that did not pass without offending device,
+// or per node otherwise
+func (r *Report) rows() [][]string {
+	rows := [][]string{}
+	for _, n := range r.Nodes {
+		if len(n.Checks) == 0 {
+			rows = append(rows, []string{n.Node, n.Status, "", "", "", "", "", "", "", n.Error})
+		}
+		for _, c := range n.Checks {
+			if len(c.Devices) == 0 {
+				rows = append(rows, []string{n.Node, n.Status, string(c.Check), string(c.Status), "", "", "", "", "", n.Error})
+			}
+			for _, d := range c.Devices {
+				threshold, maxThreshold := "", ""
+				if d.Threshold != nil {
+					threshold = strconv.FormatFloat(*d.Threshold, 'f', -1, 64)
+				}
+				if d.MaxThreshold != nil {
+					maxThreshold = strconv.FormatFloat(*d.MaxThreshold, 'f', -1, 64)
+				}
+				rows = append(rows, []string{n.Node, n.Status, string(c.Check), string(c.Status), d.DeviceID,
+					strconv.FormatFloat(d.Value, 'f', -1, 64), d.Unit, threshold, maxThreshold, n.Error})
+			}
+		}
+	}
+	return rows
+}
+
+// WriteCSV writes the report as CSV, with a header line, see rows. Totals are left out.
+func (r *Report) WriteCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	out.Write(reportColumns)
+	out.WriteAll(r.rows())
+	return out.Error()
+}
+
+// WriteTable writes the report as a plain text table, followed by the totals
+func (r *Report) WriteTable(w io.Writer) error {
+	out := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(out, strings.ToUpper(strings.Join(reportColumns, "\t")))
+	for _, row := range r.rows() {
+		for i := range row {
+			if row[i] == "" {
+				row[i] = "-"
+			}
+		}
+		fmt.Fprintln(out, strings.Join(row, "\t"))
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	t := r.Totals
+	fmt.Fprintf(w, "\nNodes: %d, OK: %d, WARN: %d, FAIL: %d, UNREACHABLE: %d, offending devices: %d\n",
+		t.Nodes, t.OK, t.Warn, t.Failed, t.Unreachable, t.Devices)
+	checks := make([]string, 0, len(t.Checks))
+	for check := range t.Checks {
+		checks = append(checks, string(check))
+	}
+	sort.Strings(checks)
+	for _, check := range checks {
+		fmt.Fprintf(w, "%s: not passing on %d node(s)\n", check, t.Checks[HealthCheck(check)])
+	}
+	_, err := fmt.Fprintf(w, "Generated: %s\n", r.Generated.Format(time.RFC3339))
+	return err
+}
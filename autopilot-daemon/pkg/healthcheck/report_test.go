@@ -0,0 +1,72 @@
+package healthcheck
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestReport tests the status of the nodes, the offending devices and the totals of a report, and its formats
+func TestReport(t *testing.T) {
+	threshold, maxThreshold := 4.0, 250.0
+	results := map[string]*NodeResult{
+		"node-1": {Node: "node-1", Results: []*CheckResult{{Check: PCIeBW, Status: StatusPass}}},
+		"node-2": {Node: "node-2", Failed: true, Results: []*CheckResult{
+			{Check: PCIeBW, Status: StatusFail, Observations: []Observation{
+				{DeviceID: "0", Value: 12.5, Unit: "GB/s", Threshold: &threshold},
+				{DeviceID: "1", Value: 2.25, Unit: "GB/s", Threshold: &threshold},
+			}},
+			{Check: RowRemap, Status: StatusFail, Observations: []Observation{{DeviceID: "0", Value: 0}, {DeviceID: "3", Value: 1}}},
+			{Check: GPUPower, Status: StatusFail, Observations: []Observation{
+				{DeviceID: "0", Value: 200, Unit: "W", MaxThreshold: &maxThreshold},
+				{DeviceID: "1", Value: 300, Unit: "W", MaxThreshold: &maxThreshold},
+			}},
+		}},
+		"node-3": {Node: "node-3", Results: []*CheckResult{{Check: DCGM, Status: StatusAbort}}},
+		"node-4": {Node: "node-4", Error: "no Autopilot pod on node node-4"},
+		"node-5": {Node: "node-5", RunError: "health check dcgm could not run", Results: []*CheckResult{{Check: PCIeBW, Status: StatusPass}}},
+	}
+	report := NewReport("pciebw,remapped", results)
+	statuses := []string{}
+	for _, n := range report.Nodes {
+		statuses = append(statuses, n.Node+"="+n.Status)
+	}
+	if got := strings.Join(statuses, ","); got != "node-1=OK,node-2=FAIL,node-3=WARN,node-4=UNREACHABLE,node-5=WARN" {
+		t.Errorf("Unexpected node statuses %s", got)
+	}
+	if c := report.Nodes[1].Checks; len(c) != 3 || len(c[0].Devices) != 1 || c[0].Devices[0].DeviceID != "1" || len(c[1].Devices) != 1 || c[1].Devices[0].DeviceID != "3" ||
+		len(c[2].Devices) != 1 || c[2].Devices[0].DeviceID != "1" {
+		t.Errorf("Expected GPU 1 of pciebw, GPU 3 of remapped and GPU 1 of gpupower to offend, got %+v", c)
+	}
+	totals := report.Totals
+	if totals.Nodes != 5 || totals.OK != 1 || totals.Failed != 1 || totals.Warn != 2 || totals.Unreachable != 1 || totals.Devices != 3 || totals.Checks[PCIeBW] != 1 || totals.Checks[GPUPower] != 1 || totals.Checks[DCGM] != 1 {
+		t.Errorf("Unexpected totals %+v", totals)
+	}
+
+	var b bytes.Buffer
+	if err := report.WriteCSV(&b); err != nil {
+		t.Fatal(err)
+	}
+	expected := `node,status,check,check_status,device,value,unit,threshold,max_threshold,error
+node-1,OK,,,,,,,,
+node-2,FAIL,pciebw,FAIL,1,2.25,GB/s,4,,
+node-2,FAIL,remapped,FAIL,3,1,,,,
+node-2,FAIL,gpupower,FAIL,1,300,W,,250,
+node-3,WARN,dcgm,ABORT,,,,,,
+node-4,UNREACHABLE,,,,,,,,no Autopilot pod on node node-4
+node-5,WARN,,,,,,,,health check dcgm could not run
+`
+	if b.String() != expected {
+		t.Errorf("Unexpected CSV:\n%s", b.String())
+	}
+
+	b.Reset()
+	if err := report.WriteTable(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"NODE    STATUS", "node-2  FAIL         pciebw    FAIL          1       2.25   GB/s  4", "Nodes: 5, OK: 1, WARN: 2, FAIL: 1, UNREACHABLE: 1, offending devices: 3", "pciebw: not passing on 1 node(s)"} {
+		if !strings.Contains(b.String(), line) {
+			t.Errorf("Expected %q in the table:\n%s", line, b.String())
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package healthcheck
+
+import (
+	"time"
+
+	"github.com/IBM/autopilot/pkg/utils"
+	"k8s.io/klog/v2"
+)
+
+type CheckStatus string
+
+const (
+	StatusPass  CheckStatus = "PASS"
+	StatusWarn  CheckStatus = "WARN"
+	StatusFail  CheckStatus = "FAIL"
+	StatusAbort CheckStatus = "ABORT"
+	StatusError CheckStatus = "ERROR"
+	// The check did not complete within its timeout
+	StatusTimeout CheckStatus = "TIMEOUT"
+)
+
+// Observation is a single measurement of a health check, usually one per GPU.
+type Observation struct {
+	// GPU id, remote node name for ping, empty for node-wide checks (e.g., dcgm, pvc)
+	DeviceID string  `json:"deviceid"`
+	Value    float64 `json:"value"`
+	Unit     string  `json:"unit,omitempty"`
+	// Lowest acceptable value, if the check compares the value against a threshold
+	Threshold *float64 `json:"threshold,omitempty"`
+	// Highest acceptable value, if the check compares the value against a maximum (e.g., from a threshold profile)
+	MaxThreshold *float64 `json:"maxthreshold,omitempty"`
+}
+
+// outOfBounds tells whether the value is below its threshold or above its maximum
+func (o Observation) outOfBounds() bool {
+	return (o.Threshold != nil && o.Value < *o.Threshold) || (o.MaxThreshold != nil && o.Value > *o.MaxThreshold)
+}
+
+// hasBounds tells whether the value is compared against a threshold or a maximum
+func (o Observation) hasBounds() bool {
+	return o.Threshold != nil || o.MaxThreshold != nil
+}
+
+// CheckResult is the outcome of a single health check run on the local node.
+type CheckResult struct {
+	Check        HealthCheck   `json:"check"`
+	Status       CheckStatus   `json:"status"`
+	Observations []Observation `json:"observations,omitempty"`
+	Start        time.Time     `json:"start"`
+	// Duration of the run, in nanoseconds when serialized
+	Duration time.Duration `json:"duration"`
+	// Raw output of the check
+	Log string `json:"log"`
+	// Threshold profile applied to the observations, if any
+	Profile string `json:"profile,omitempty"`
+}
+
+func newCheckResult(check HealthCheck) *CheckResult {
+	return &CheckResult{
+		Check:  check,
+		Status: StatusPass,
+		Start:  time.Now(),
+	}
+}
+
+// Failed tells whether the result should count against the node health
+func (r *CheckResult) Failed() bool {
+	return r.Status == StatusFail
+}
+
+func (r *CheckResult) addObservation(deviceid string, value float64, unit string) {
+	r.Observations = append(r.Observations, Observation{DeviceID: deviceid, Value: value, Unit: unit})
+}
+
+func (r *CheckResult) finish(out []byte) *CheckResult {
+	r.Log = string(out)
+	r.Duration = time.Since(r.Start)
+	return r
+}
+
+// updateMetrics exports the observations of a result through the health checks gauge
+func updateMetrics(c Checker, result *CheckResult) {
+	exportObservations(c, result.Observations)
+}
+
+func exportObservations(c Checker, observations []Observation) {
+	name := c.Metadata().MetricName
+	if name == "" {
+		name = string(c.Name())
+	}
+	for _, o := range observations {
+		klog.Info("Observation: ", utils.NodeName, " ", name, " ", o.DeviceID, " ", o.Value, " ", o.Unit)
+		utils.HchecksGauge.WithLabelValues(name, utils.NodeName, utils.CPUModel, utils.GPUModel, o.DeviceID).Set(o.Value)
+	}
+}
@@ -0,0 +1,234 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/thanhpk/randstr"
+	"k8s.io/klog/v2"
+)
+
+type RunState string
+
+const (
+	// The run waits for the health check lock, held by other checks
+	RunQueued    RunState = "queued"
+	RunRunning   RunState = "running"
+	RunCompleted RunState = "completed"
+	// The run could not be executed, or some of its checks could not
+	RunFailed    RunState = "failed"
+	RunCancelled RunState = "cancelled"
+)
+
+// Run is a set of checks running in the background, on the local node or on remote nodes
+type Run struct {
+	ID       string    `json:"id"`
+	State    RunState  `json:"state"`
+	Checks   string    `json:"checks"`
+	Hosts    string    `json:"hosts"`
+	Created  time.Time `json:"created"`
+	Finished time.Time `json:"finished"`
+	// Position of queued runs in the queue of the health check lock, starting at 1
+	Position int `json:"position,omitempty"`
+	// Progress of the run: number of checks completed on the local node, or of remote nodes completed, out of Total
+	Completed int            `json:"completed"`
+	Total     int            `json:"total"`
+	Results   []*CheckResult `json:"results,omitempty"`
+	// Outcome of the checks run on remote nodes, by node, added as each node completes
+	Nodes map[string]*NodeResult `json:"nodes,omitempty"`
+	Error string                 `json:"error,omitempty"`
+
+	cancel context.CancelFunc
+}
+
+// RunStore tracks the background runs, and forgets them once finished for longer than the retention.
+// It is safe for concurrent use.
+type RunStore struct {
+	lock      sync.Mutex
+	runs      map[string]*Run
+	retention time.Duration
+}
+
+func NewRunStore(retention time.Duration) *RunStore {
+	return &RunStore{runs: make(map[string]*Run), retention: retention}
+}
+
+// The background runs of the node
+var Runs = NewRunStore(GetRunRetention())
+
+// GetRunRetention returns how long finished runs are kept, from RUN_RETENTION. Defaults to 1h
+func GetRunRetention() time.Duration {
+	retention, _ := runRetention()
+	return retention
+}
+
+func runRetention() (time.Duration, error) {
+	return envDuration("RUN_RETENTION", time.Hour)
+}
+
+// RunFunc executes a run. Results passed to RunCheck under ctx are added to the run as they complete, and so are
+// the nodes of RunRemote under ctx, whose selection sets the total of the run.
+type RunFunc func(ctx context.Context, run *Run) error
+
+// Start executes fn in the background and returns a copy of the new run
+func (s *RunStore) Start(checks string, hosts string, total int, fn RunFunc) Run {
+	return s.start(checks, hosts, total, RunRunning, fn)
+}
+
+// StartQueued is like Start, for a run waiting for the health check lock. fn reports its position with SetQueued,
+// then calls SetRunning once the lock is taken.
+func (s *RunStore) StartQueued(checks string, hosts string, total int, fn RunFunc) Run {
+	return s.start(checks, hosts, total, RunQueued, fn)
+}
+
+func (s *RunStore) start(checks string, hosts string, total int, state RunState, fn RunFunc) Run {
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &Run{
+		ID:      randstr.Hex(16),
+		State:   state,
+		Checks:  checks,
+		Hosts:   hosts,
+		Created: time.Now(),
+		Total:   total,
+		cancel:  cancel,
+	}
+	s.lock.Lock()
+	s.purge()
+	s.runs[run.ID] = run
+	snapshot := *run
+	s.lock.Unlock()
+
+	klog.Info("Starting run ", run.ID, " of ", checks, " on ", hosts)
+	ctx = WithResultHook(ctx, func(result *CheckResult) {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		run.Results = append(run.Results, result)
+		run.Completed++
+	})
+	ctx = WithNodeHook(ctx, func(nodes []string) {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		run.Total = len(nodes)
+		run.Completed = 0
+		run.Nodes = make(map[string]*NodeResult, len(nodes))
+	}, func(result *NodeResult) {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		run.Nodes[result.Node] = result
+		run.Completed++
+	})
+	go func() {
+		defer cancel()
+		err := fn(ctx, run)
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		run.Finished = time.Now()
+		run.Position = 0
+		switch {
+		case errors.Is(ctx.Err(), context.Canceled):
+			run.State = RunCancelled
+		case err != nil:
+			run.State = RunFailed
+			run.Error = err.Error()
+		default:
+			run.State = RunCompleted
+		}
+		klog.Info("Run ", run.ID, " ", run.State)
+	}()
+	return snapshot
+}
+
+// SetQueued sets the position of a queued run
+func (s *RunStore) SetQueued(run *Run, position int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	run.Position = position
+}
+
+// SetRunning marks a queued run as running
+func (s *RunStore) SetRunning(run *Run) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	run.State = RunRunning
+	run.Position = 0
+}
+
+// Get returns a copy of a run
+func (s *RunStore) Get(id string) (Run, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.purge()
+	run, found := s.runs[id]
+	if !found {
+		return Run{}, false
+	}
+	return run.copy(), true
+}
+
+// List returns a copy of all the runs, the most recent first
+func (s *RunStore) List() []Run {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.purge()
+	runs := make([]Run, 0, len(s.runs))
+	for _, run := range s.runs {
+		runs = append(runs, run.copy())
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].Created.After(runs[j].Created)
+	})
+	return runs
+}
+
+// Cancel stops a queued or running run, or forgets a finished one. Returns a copy of the run.
+func (s *RunStore) Cancel(id string) (Run, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	run, found := s.runs[id]
+	if !found {
+		return Run{}, false
+	}
+	if run.Finished.IsZero() {
+		klog.Info("Cancelling run ", id)
+		run.cancel()
+	} else {
+		delete(s.runs, id)
+	}
+	return run.copy(), true
+}
+
+// CancelAll stops all the queued and running runs, e.g., when the daemon stops
+func (s *RunStore) CancelAll() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for id, run := range s.runs {
+		if run.Finished.IsZero() {
+			klog.Info("Cancelling run ", id)
+			run.cancel()
+		}
+	}
+}
+
+func (r *Run) copy() Run {
+	c := *r
+	c.Results = append([]*CheckResult(nil), r.Results...)
+	if r.Nodes != nil {
+		c.Nodes = make(map[string]*NodeResult, len(r.Nodes))
+		for node, result := range r.Nodes {
+			c.Nodes[node] = result
+		}
+	}
+	return c
+}
+
+// purge forgets the runs finished for longer than the retention. The caller must hold the lock.
+func (s *RunStore) purge() {
+	for id, run := range s.runs {
+		if !run.Finished.IsZero() && time.Since(run.Finished) > s.retention {
+			delete(s.runs, id)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitRun polls a run until it is finished
+func waitRun(t *testing.T, s *RunStore, id string) Run {
+	for i := 0; i < 100; i++ {
+		run, found := s.Get(id)
+		if !found {
+			t.Fatalf("Run %s not found", id)
+		}
+		if !run.Finished.IsZero() {
+			return run
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Run %s did not finish", id)
+	return Run{}
+}
+
+// TestRunStore tests the progress, the cancellation and the retention of background runs
+func TestRunStore(t *testing.T) {
+	Register(fakeCheck{"fake-run", true})
+	s := NewRunStore(time.Hour)
+
+	run := s.Start("fake-run", "node", 2, func(ctx context.Context, run *Run) error {
+		_, err := RunHealthLocalNode(ctx, "fake-run,fake-run", "1", "None", "None", nil)
+		return err
+	})
+	if run.State != RunRunning || run.Total != 2 {
+		t.Errorf("Expected a running run of 2 checks, got %+v", run)
+	}
+	run = waitRun(t, s, run.ID)
+	if run.State != RunCompleted || run.Completed != 2 || len(run.Results) != 2 {
+		t.Errorf("Expected 2 completed checks, got %+v", run)
+	}
+
+	failed := s.Start("fake-run", "node", 1, func(ctx context.Context, run *Run) error {
+		return errors.New("cannot run")
+	})
+	if failed = waitRun(t, s, failed.ID); failed.State != RunFailed || failed.Error != "cannot run" {
+		t.Errorf("Expected a failed run, got %+v", failed)
+	}
+
+	cancelled := s.Start("fake-run", "node", 1, func(ctx context.Context, run *Run) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if _, found := s.Cancel(cancelled.ID); !found {
+		t.Fatalf("Run %s not found", cancelled.ID)
+	}
+	if cancelled = waitRun(t, s, cancelled.ID); cancelled.State != RunCancelled {
+		t.Errorf("Expected a cancelled run, got %+v", cancelled)
+	}
+	if runs := s.List(); len(runs) != 3 || runs[0].ID != cancelled.ID {
+		t.Errorf("Expected 3 runs, the most recent first, got %+v", runs)
+	}
+
+	// Finished runs are deleted, then forgotten after the retention
+	if _, found := s.Cancel(cancelled.ID); !found {
+		t.Fatalf("Run %s not found", cancelled.ID)
+	}
+	if _, found := s.Get(cancelled.ID); found {
+		t.Errorf("Expected run %s to be deleted", cancelled.ID)
+	}
+	s.retention = 0
+	if runs := s.List(); len(runs) != 0 {
+		t.Errorf("Expected the finished runs to be forgotten, got %d", len(runs))
+	}
+
+	// Shutdown cancels the queued and running runs
+	s.retention = time.Hour
+	wait := func(ctx context.Context, run *Run) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	queued := s.StartQueued("fake-run", "node", 1, wait)
+	running := s.Start("fake-run", "node", 1, wait)
+	if queued.State != RunQueued {
+		t.Errorf("Expected a queued run, got %+v", queued)
+	}
+	s.CancelAll()
+	for _, id := range []string{queued.ID, running.ID} {
+		if run := waitRun(t, s, id); run.State != RunCancelled {
+			t.Errorf("Expected a cancelled run, got %+v", run)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/autopilot/pkg/utils"
+	"k8s.io/klog/v2"
+)
+
+// Schedule tells when a periodic job runs next
+type Schedule interface {
+	// Next activation strictly after t
+	Next(t time.Time) time.Time
+}
+
+// ScheduledJob runs a set of checks together, on its own schedule
+type ScheduledJob struct {
+	// Comma separated list of checks
+	Checks   string
+	Schedule Schedule
+	// Optional, replaces the periodic run of Checks (e.g., to launch invasive checks)
+	Run func(ctx context.Context)
+}
+
+// intervalSchedule runs at anchor+offset, then every interval
+type intervalSchedule struct {
+	anchor   time.Time
+	interval time.Duration
+	offset   time.Duration
+}
+
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	first := s.anchor.Add(s.offset)
+	if t.Before(first) {
+		return first
+	}
+	k := t.Sub(first)/s.interval + 1
+	return first.Add(k * s.interval)
+}
+
+func NewIntervalSchedule(anchor time.Time, interval time.Duration, offset time.Duration) Schedule {
+	return intervalSchedule{anchor: anchor, interval: interval, offset: offset}
+}
+
+// splaySchedule delays every activation of a schedule by a fixed amount
+type splaySchedule struct {
+	schedule Schedule
+	splay    time.Duration
+}
+
+func (s splaySchedule) Next(t time.Time) time.Time {
+	next := s.schedule.Next(t.Add(-s.splay))
+	if next.IsZero() {
+		return next
+	}
+	return next.Add(s.splay)
+}
+
+// WithSplay delays the activations of s by the node splay of the given key, at most max
+func WithSplay(s Schedule, key string, max time.Duration) Schedule {
+	splay := utils.Splay(utils.NodeName, key, max)
+	if splay == 0 {
+		return s
+	}
+	klog.Info("Splay for ", key, " on node ", utils.NodeName, ": ", splay)
+	return splaySchedule{schedule: s, splay: splay}
+}
+
+// cronSchedule runs at the times matching a standard 5 fields cron expression, shifted by offset
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// Day of month and day of week are OR-ed when both are restricted, as in cron
+	domStar, dowStar bool
+	offset           time.Duration
+}
+
+func (s cronSchedule) Next(t time.Time) time.Time {
+	t = t.Add(-s.offset).Truncate(time.Minute).Add(time.Minute)
+	// Give up after five years, for expressions that can never match (e.g., Feb 30th)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t.Add(s.offset)
+	}
+	return time.Time{}
+}
+
+func (s cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// parseCron parses a 5 fields cron expression (minute hour day-of-month month day-of-week) or a macro like @daily
+func parseCron(expr string) (cronSchedule, error) {
+	if macro, found := cronMacros[expr]; found {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return cronSchedule{}, fmt.Errorf("invalid cron expression %q: must have 5 fields", expr)
+	}
+	s := cronSchedule{}
+	var err error
+	bounds := []struct {
+		field    *uint64
+		min, max int
+	}{
+		{&s.minute, 0, 59},
+		{&s.hour, 0, 23},
+		{&s.dom, 1, 31},
+		{&s.month, 1, 12},
+		{&s.dow, 0, 7},
+	}
+	for i, b := range bounds {
+		*b.field, err = parseCronField(fields[i], b.min, b.max)
+		if err != nil {
+			return cronSchedule{}, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+		}
+	}
+	// Sunday is either 0 or 7
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domStar = fields[2] == "*"
+	s.dowStar = fields[4] == "*"
+	return s, nil
+}
+
+// parseCronField parses a comma separated list of values, ranges (a-b) and steps (*/n, a-b/n) into a bit set
+func parseCronField(field string, min int, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepStr)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepStr)
+			}
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			loStr, hiStr, isRange := strings.Cut(rng, "-")
+			var err error
+			lo, err = strconv.Atoi(loStr)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", loStr)
+			}
+			hi = lo
+			if isRange {
+				hi, err = strconv.Atoi(hiStr)
+				if err != nil {
+					return 0, fmt.Errorf("invalid value %q", hiStr)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("value out of range [%d-%d] in %q", min, max, part)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// parseSchedule parses a schedule: either an interval (e.g., "1h") or "cron:<expression>",
+// optionally followed by "+<offset>" (e.g., "24h+2h", "cron:0 3 * * *+15m")
+func parseSchedule(spec string, anchor time.Time) (Schedule, error) {
+	spec, offsetStr, hasOffset := strings.Cut(strings.TrimSpace(spec), "+")
+	var offset time.Duration
+	if hasOffset {
+		var err error
+		offset, err = utils.ParseInterval(strings.TrimSpace(offsetStr))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if expr, isCron := strings.CutPrefix(spec, "cron:"); isCron {
+		s, err := parseCron(strings.TrimSpace(expr))
+		if err != nil {
+			return nil, err
+		}
+		s.offset = offset
+		return s, nil
+	}
+	interval, err := utils.ParseInterval(spec)
+	if err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		return nil, nil
+	}
+	return intervalSchedule{anchor: anchor, interval: interval, offset: offset}, nil
+}
+
+// GetScheduledJobs builds the periodic jobs. Checks listed in CHECK_SCHEDULES (e.g., "ping=5m;pciebw=cron:0 3 * * *")
+// run on their own schedule. The remaining checks of PERIODIC_CHECKS run together every defaultInterval.
+// A zero interval disables the job. Interval schedules start at anchor, and every job is delayed by its node splay, up to splay.
+func GetScheduledJobs(defaultInterval time.Duration, anchor time.Time, splay time.Duration) ([]ScheduledJob, error) {
+	jobs := []ScheduledJob{}
+	scheduled := make(map[string]bool)
+	for _, entry := range strings.Split(os.Getenv("CHECK_SCHEDULES"), ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, spec, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid entry %q: must be like 'check=schedule'", entry)
+		}
+		if _, found := GetChecker(HealthCheck(name)); !found {
+			return nil, fmt.Errorf("health check not supported: %q", name)
+		}
+		schedule, err := parseSchedule(spec, anchor)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule for %s: %w", name, err)
+		}
+		scheduled[name] = true
+		if schedule == nil {
+			klog.Info("Periodic runs disabled for ", name)
+			continue
+		}
+		jobs = append(jobs, ScheduledJob{Checks: name, Schedule: WithSplay(schedule, name, splay)})
+	}
+	remaining := []string{}
+	for _, check := range strings.Split(GetPeriodicChecks(), ",") {
+		if check != "" && !scheduled[check] {
+			remaining = append(remaining, check)
+		}
+	}
+	if len(remaining) > 0 && defaultInterval > 0 {
+		jobs = append(jobs, ScheduledJob{
+			Checks:   strings.Join(remaining, ","),
+			Schedule: WithSplay(NewIntervalSchedule(anchor, defaultInterval, 0), "periodic", splay),
+		})
+	}
+	return jobs, nil
+}
+
+// RunScheduler runs each job on its own schedule until ctx is done. Runs take the health check lock,
+// so they never overlap with each other or with on-demand checks. Activations missed while a job
+// waits for the lock or is still running are skipped.
+func RunScheduler(ctx context.Context, jobs []ScheduledJob) {
+	for _, job := range jobs {
+		go runJob(ctx, job)
+	}
+	<-ctx.Done()
+}
+
+func runJob(ctx context.Context, job ScheduledJob) {
+	next := job.Schedule.Next(time.Now().Add(-time.Nanosecond))
+	for !next.IsZero() {
+		klog.Info("Next periodic run of ", job.Checks, " at ", next.Format(time.RFC3339))
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if job.Run != nil {
+			job.Run(ctx)
+		} else {
+			PeriodicCheck(ctx, job.Checks)
+		}
+		next = job.Schedule.Next(time.Now())
+	}
+	klog.Info("No next periodic run of ", job.Checks)
+}
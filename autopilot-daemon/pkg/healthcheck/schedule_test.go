@@ -0,0 +1,49 @@
+package healthcheck
+
+import (
+	"testing"
+	"time"
+)
+
+// TestParseSchedule tests interval and cron schedules, with and without offset
+func TestParseSchedule(t *testing.T) {
+	anchor := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		spec     string
+		after    time.Time
+		expected time.Time
+	}{
+		{"5m", anchor.Add(-time.Nanosecond), anchor},
+		{"5m", anchor, anchor.Add(5 * time.Minute)},
+		{"1h+10m", anchor.Add(-time.Nanosecond), anchor.Add(10 * time.Minute)},
+		{"1h+10m", anchor.Add(75 * time.Minute), anchor.Add(130 * time.Minute)},
+		{"cron:0 3 * * *", anchor, time.Date(2024, 5, 11, 3, 0, 0, 0, time.UTC)},
+		{"cron:0 3 * * *+15m", anchor, time.Date(2024, 5, 11, 3, 15, 0, 0, time.UTC)},
+		{"cron:*/20 * * * *", anchor, anchor.Add(20 * time.Minute)},
+		{"cron:30 8-10 * * 1-5", anchor, time.Date(2024, 5, 13, 8, 30, 0, 0, time.UTC)},
+		{"cron:0 0 1 * *", anchor, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{"cron:@hourly", anchor, anchor.Add(time.Hour)},
+		{"cron:0 0 * * 7", anchor, time.Date(2024, 5, 12, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		s, err := parseSchedule(test.spec, anchor)
+		if err != nil {
+			t.Errorf("Expected no error for %q, got %v", test.spec, err)
+			continue
+		}
+		if next := s.Next(test.after); !next.Equal(test.expected) {
+			t.Errorf("Expected %v for %q after %v, got %v", test.expected, test.spec, test.after, next)
+		}
+	}
+
+	if s, err := parseSchedule("0", anchor); err != nil || s != nil {
+		t.Errorf("Expected a disabled schedule for 0, got %v and %v", s, err)
+	}
+
+	invalid := []string{"abc", "1h+x", "cron:* * *", "cron:60 * * * *", "cron:*/0 * * * *", "cron:5-1 * * * *"}
+	for _, spec := range invalid {
+		if _, err := parseSchedule(spec, anchor); err == nil {
+			t.Errorf("Expected error for %q, got nil", spec)
+		}
+	}
+}
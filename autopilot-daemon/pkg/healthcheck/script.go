@@ -0,0 +1,83 @@
+package healthcheck
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// scriptCheck is a health check implemented by an executable found in the checks directory.
+// The check is named after the file, without extension, and its request parameters are passed
+// as AUTOPILOT_PARAM_<NAME> environment variables. The executable is expected to speak the result protocol.
+type scriptCheck struct {
+	name HealthCheck
+	path string
+}
+
+func (s scriptCheck) Name() HealthCheck { return s.name }
+
+func (s scriptCheck) Run(ctx context.Context, params url.Values) (*CheckResult, error) {
+	result := newCheckResult(s.name)
+	stdout, stderr, err := runScriptWithEnv(ctx, paramsEnv(params), s.path)
+	if err != nil {
+		out := append(stderr, stdout...)
+		klog.Info("Out:", string(out))
+		return result.finish(out), err
+	}
+	return parseOutput(result, stdout, stderr, parseLegacyScript)
+}
+
+func (s scriptCheck) Metadata() CheckMetadata {
+	return CheckMetadata{
+		Description: "Custom health check " + s.path,
+		Timeout:     10 * time.Minute,
+	}
+}
+
+// Scripts not speaking the protocol fail if their output contains FAIL, and abort if it contains ABORT
+func parseLegacyScript(result *CheckResult, out []byte) (*CheckResult, error) {
+	defer result.finish(out)
+	if strings.Contains(string(out[:]), "FAIL") {
+		result.Status = StatusFail
+	}
+	if strings.Contains(string(out[:]), "ABORT") {
+		abort(result)
+	}
+	return result, nil
+}
+
+// LoadScriptChecks registers every executable file in dir as a health check.
+// Files whose name is not a valid check name, or collides with an already registered check, are skipped.
+func LoadScriptChecks(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		klog.V(2).Info("No custom health checks loaded from ", dir, ": ", err.Error())
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+			continue
+		}
+		name := HealthCheck(strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())))
+		if err := validateCheckName(string(name)); err != nil {
+			klog.Error("Skipping health check executable ", entry.Name(), ": ", err.Error())
+			continue
+		}
+		if _, found := GetChecker(name); found {
+			klog.Info("Health check ", name, " already registered, skipping ", entry.Name())
+			continue
+		}
+		path, err := filepath.Abs(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		klog.Info("Loaded custom health check ", name, " from ", path)
+		Register(scriptCheck{name: name, path: path})
+	}
+}
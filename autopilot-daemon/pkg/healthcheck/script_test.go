@@ -0,0 +1,26 @@
+package healthcheck
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestLoadScriptChecks tests that executables are registered after their file name, unless it is not a valid check name
+func TestLoadScriptChecks(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"script-ok.sh", ".keep", "status", "api.py", "a,b.sh", "Upper.sh"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\necho PASS\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	LoadScriptChecks(dir)
+	if _, found := GetChecker("script-ok"); !found {
+		t.Errorf("Expected script-ok to be registered")
+	}
+	for _, name := range []HealthCheck{"", "status", "api", "a,b", "Upper"} {
+		if _, found := GetChecker(name); found {
+			t.Errorf("Expected %q not to be registered", name)
+		}
+	}
+}
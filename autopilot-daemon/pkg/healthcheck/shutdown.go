@@ -0,0 +1,58 @@
+package healthcheck
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/IBM/autopilot/pkg/utils"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// How long Shutdown waits for the iperf servers to stop
+const iperfStopTimeout = 5 * time.Second
+
+// How long Shutdown waits for the pod of the invasive health checks Job to be gone
+const invasiveJobStopTimeout = 10 * time.Second
+
+// Shutdown stops the health checks before the daemon exits, and cleans up what they leave behind when interrupted.
+// The periodic and on-demand checks must already be cancelled through their contexts; the background runs are cancelled
+// here. Once the running checks are done, or ctx is done, it stops the iperf servers, deletes the PVC of the pvc check,
+// deletes the invasive health checks Job, and restores the gpuhealth label if this daemon set it to TESTING, once the Job
+// is gone. No check starts after Shutdown.
+func Shutdown(ctx context.Context) {
+	klog.Info("Shutting down the health checks")
+	Runs.CancelAll()
+	// Taking the lock for good waits for the running checks, and keeps new ones from starting
+	if err := utils.HealthcheckLock.Wait(ctx, "shutdown", -1, nil); err != nil {
+		holder, _ := utils.HealthcheckLock.Holder()
+		klog.Info("Health checks ", holder.Checks, " still running, cleaning up anyway: ", err.Error())
+	}
+	// ctx may be done already, the servers are stopped anyway
+	stopCtx, cancel := context.WithTimeout(context.Background(), iperfStopTimeout)
+	defer cancel()
+	if _, err := StopAllIperfServers(stopCtx); err != nil {
+		klog.Info("Cannot stop the iperf servers: ", err.Error())
+	}
+	if _, exists := os.LookupEnv("PVC_TEST_STORAGE_CLASS"); exists {
+		err := utils.GetClientsetInstance().Cset.CoreV1().PersistentVolumeClaims(utils.Namespace).Delete(context.Background(), utils.PodName, metav1.DeleteOptions{})
+		switch {
+		case err == nil:
+			klog.Info("Deleted the PVC ", utils.PodName)
+		case !apierrors.IsNotFound(err):
+			klog.Info("Cannot delete the PVC ", utils.PodName, ": ", err.Error())
+		}
+	}
+	// The Job may still hold the GPUs, and would set the label itself when done
+	jobCtx, cancelJob := context.WithTimeout(context.Background(), invasiveJobStopTimeout)
+	defer cancelJob()
+	if err := StopInvasiveJob(jobCtx); err != nil {
+		klog.Info("Cannot delete the invasive health checks Job, not restoring the gpuhealth label: ", err.Error())
+		return
+	}
+	if err := utils.RestoreGPUHealth(utils.NodeName); err != nil {
+		klog.Info("Cannot restore the gpuhealth label: ", err.Error())
+	}
+}
@@ -0,0 +1,166 @@
+package healthcheck
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/IBM/autopilot/pkg/utils"
+	"k8s.io/klog/v2"
+)
+
+// CheckState is what the node knows about a health check, from its past runs
+type CheckState struct {
+	Check HealthCheck `json:"check"`
+	// Status of the last run
+	Status CheckStatus `json:"status,omitempty"`
+	// Whether the check counts against the node health, once the fail-after and recover-after thresholds are applied
+	Failed      bool      `json:"failed"`
+	LastRun     time.Time `json:"lastRun"`
+	LastSuccess time.Time `json:"lastSuccess"`
+	// Error of the last run that did not complete, and when it happened
+	LastError     string    `json:"lastError,omitempty"`
+	LastErrorTime time.Time `json:"lastErrorTime"`
+	Streak
+	// Observations exported through the health checks gauge
+	Observations []Observation `json:"observations,omitempty"`
+}
+
+// Streak counts the consecutive failed and successful runs of a check.
+// At most one of the two counters is non zero.
+type Streak struct {
+	Failures  int `json:"failures"`
+	Successes int `json:"successes"`
+}
+
+// StateStore holds the state of the health checks of the node. It is safe for concurrent use.
+type StateStore struct {
+	lock   sync.RWMutex
+	checks map[HealthCheck]*CheckState
+}
+
+func NewStateStore() *StateStore {
+	return &StateStore{checks: make(map[HealthCheck]*CheckState)}
+}
+
+// The state of the node health checks, source of the node labels and of the health checks gauge
+var State = NewStateStore()
+
+// Init resets the store to the given checks, none of them failed
+func (s *StateStore) Init(checks []HealthCheck) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.checks = make(map[HealthCheck]*CheckState)
+	for _, check := range checks {
+		s.checks[check] = &CheckState{Check: check}
+	}
+}
+
+// Record updates the state of a check with the result of a run. The check is marked as failed after
+// CHECK_FAIL_AFTER consecutive failures, and back after CHECK_RECOVER_AFTER consecutive successes.
+// Runs that did not complete (ABORT, ERROR, TIMEOUT) count toward neither.
+// Returns whether the outcome of the run agrees with the state of the check, once updated.
+func (s *StateStore) Record(result *CheckResult, err error) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	check := result.Check
+	state, found := s.checks[check]
+	if !found {
+		state = &CheckState{Check: check}
+		s.checks[check] = state
+	}
+	state.Status = result.Status
+	state.LastRun = result.Start
+	if result.Status == StatusPass || result.Status == StatusWarn {
+		state.LastSuccess = result.Start
+	}
+	if err != nil {
+		state.LastError = err.Error()
+		state.LastErrorTime = result.Start
+	}
+
+	// ABORT, ERROR and TIMEOUT runs tell nothing about the health of the node: they leave the streaks as they are
+	failed := result.Failed()
+	switch result.Status {
+	case StatusFail:
+		state.Failures++
+		state.Successes = 0
+	case StatusPass, StatusWarn:
+		state.Successes++
+		state.Failures = 0
+	default:
+		klog.Info("Health check ", check, " completed with status ", result.Status, ", streaks unchanged")
+		return false
+	}
+	utils.HchecksStreak.WithLabelValues(string(check), utils.NodeName, "fail").Set(float64(state.Failures))
+	utils.HchecksStreak.WithLabelValues(string(check), utils.NodeName, "pass").Set(float64(state.Successes))
+
+	switch {
+	case failed && !state.Failed && state.Failures >= getCount(failAfter, check):
+		klog.Info("Health check ", check, " failed ", state.Failures, " times in a row, marking it as failed")
+		state.Failed = true
+	case !failed && state.Failed && state.Successes >= getCount(recoverAfter, check):
+		klog.Info("Health check ", check, " passed ", state.Successes, " times in a row, marking it as recovered")
+		state.Failed = false
+	case failed != state.Failed:
+		klog.Info("Health check ", check, " status unchanged, failures: ", state.Failures, " successes: ", state.Successes)
+	}
+	if state.Failed == failed {
+		state.Observations = append([]Observation(nil), result.Observations...)
+		return true
+	}
+	return false
+}
+
+// Restore replaces the state of the given checks, e.g., as saved before a restart
+func (s *StateStore) Restore(states []CheckState) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i := range states {
+		state := states[i]
+		s.checks[state.Check] = &state
+		utils.HchecksStreak.WithLabelValues(string(state.Check), utils.NodeName, "fail").Set(float64(state.Failures))
+		utils.HchecksStreak.WithLabelValues(string(state.Check), utils.NodeName, "pass").Set(float64(state.Successes))
+	}
+}
+
+// Get returns a copy of the state of a check
+func (s *StateStore) Get(check HealthCheck) (CheckState, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	state, found := s.checks[check]
+	if !found {
+		return CheckState{}, false
+	}
+	return *state, true
+}
+
+// List returns a copy of the state of all the checks, sorted by name
+func (s *StateStore) List() []CheckState {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	states := make([]CheckState, 0, len(s.checks))
+	for _, state := range s.checks {
+		states = append(states, *state)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Check < states[j].Check
+	})
+	return states
+}
+
+// Failed tells whether any check counts against the node health. Informational checks are ignored.
+func (s *StateStore) Failed() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	for check, state := range s.checks {
+		if !state.Failed {
+			continue
+		}
+		if c, found := GetChecker(check); found && c.Metadata().Informational {
+			continue
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package healthcheck
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestStateRecord tests that a check is marked as failed or recovered only after enough consecutive runs
+func TestStateRecord(t *testing.T) {
+	s := NewStateStore()
+	s.Init([]HealthCheck{Ping})
+	failAfter = map[HealthCheck]int{Ping: 3}
+	recoverAfter = map[HealthCheck]int{Ping: 2}
+	defer func() {
+		failAfter, recoverAfter = nil, nil
+	}()
+
+	runs := []struct {
+		failed   bool
+		status   bool
+		exported bool
+	}{
+		{true, false, false},
+		{true, false, false},
+		{false, false, true}, // a success resets the failure streak
+		{true, false, false},
+		{true, false, false},
+		{true, true, true},
+		{false, true, false},
+		{true, true, true},
+		{false, true, false},
+		{false, false, true},
+	}
+	for i, run := range runs {
+		result := newCheckResult(Ping)
+		if run.failed {
+			result.Status = StatusFail
+		}
+		exported := s.Record(result, nil)
+		state, _ := s.Get(Ping)
+		if state.Failed != run.status || exported != run.exported {
+			t.Errorf("Run %d: expected failed %v and exported %v, got %v and %v", i, run.status, run.exported, state.Failed, exported)
+		}
+		if s.Failed() != run.status {
+			t.Errorf("Run %d: expected node failed %v, got %v", i, run.status, s.Failed())
+		}
+	}
+
+	// Runs that did not complete neither break a failure streak nor count toward recovery
+	s.Init([]HealthCheck{Ping})
+	failAfter[Ping] = 2
+	for i, status := range []CheckStatus{StatusFail, StatusTimeout, StatusFail} {
+		result := newCheckResult(Ping)
+		result.Status = status
+		if exported := s.Record(result, nil); status == StatusTimeout && exported {
+			t.Errorf("Run %d: expected a timeout not to be exported", i)
+		}
+	}
+	if state, _ := s.Get(Ping); !state.Failed || state.Failures != 2 {
+		t.Errorf("Expected FAIL, TIMEOUT, FAIL to fail, got %+v", state)
+	}
+	for _, status := range []CheckStatus{StatusFail, StatusAbort, StatusAbort, StatusAbort, StatusError} {
+		result := newCheckResult(Ping)
+		result.Status = status
+		s.Record(result, nil)
+	}
+	if state, _ := s.Get(Ping); !state.Failed || state.Successes != 0 || state.Failures != 3 {
+		t.Errorf("Expected FAIL then aborted runs to stay failed, got %+v", state)
+	}
+
+	// Checks without thresholds follow each run, and keep track of errors
+	result := newCheckResult(PCIeBW)
+	result.Status = StatusFail
+	if s.Record(result, errors.New("broken")); !s.Failed() {
+		t.Errorf("Expected %s to fail after a single failure", PCIeBW)
+	}
+	state, found := s.Get(PCIeBW)
+	if !found || state.LastError != "broken" || !state.LastSuccess.IsZero() || state.LastRun != result.Start {
+		t.Errorf("Unexpected state %+v", state)
+	}
+	if states := s.List(); len(states) != 2 || states[0].Check != PCIeBW {
+		t.Errorf("Expected the states of 2 checks sorted by name, got %+v", states)
+	}
+
+	if _, err := parseCheckCounts("ping=0"); err == nil {
+		t.Errorf("Expected error for a zero count")
+	}
+}
@@ -0,0 +1,91 @@
+package healthcheck
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IBM/autopilot/pkg/utils"
+)
+
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// OutputLine is a line written by a health check while it runs, on the local node or on a remote node
+type OutputLine struct {
+	Node   string      `json:"node"`
+	Check  HealthCheck `json:"check,omitempty"`
+	Stream string      `json:"stream"`
+	Line   string      `json:"line"`
+	Time   time.Time   `json:"time"`
+}
+
+type outputHookKey struct{}
+
+type checkNameKey struct{}
+
+// WithOutputHook returns a context under which the commands run by the checks pass every line of their
+// standard output and standard error to hook, as soon as it is written. The hook may be called concurrently.
+func WithOutputHook(ctx context.Context, hook func(OutputLine)) context.Context {
+	return context.WithValue(ctx, outputHookKey{}, hook)
+}
+
+// withCheckName records the check running under ctx, to tag the lines of its output
+func withCheckName(ctx context.Context, check HealthCheck) context.Context {
+	return context.WithValue(ctx, checkNameKey{}, check)
+}
+
+// outputWriters returns the writers streaming the standard output and standard error of a command run under ctx,
+// or nil if nobody is listening
+func outputWriters(ctx context.Context) (*lineWriter, *lineWriter) {
+	hook, found := ctx.Value(outputHookKey{}).(func(OutputLine))
+	if !found {
+		return nil, nil
+	}
+	check, _ := ctx.Value(checkNameKey{}).(HealthCheck)
+	return &lineWriter{hook: hook, check: check, stream: StreamStdout},
+		&lineWriter{hook: hook, check: check, stream: StreamStderr}
+}
+
+// lineWriter passes the lines written to it to a hook
+type lineWriter struct {
+	lock   sync.Mutex
+	hook   func(OutputLine)
+	check  HealthCheck
+	stream string
+	buf    []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush passes the last line, if it does not end with a newline
+func (w *lineWriter) Flush() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if len(w.buf) > 0 {
+		w.emit(string(w.buf))
+		w.buf = nil
+	}
+}
+
+func (w *lineWriter) emit(line string) {
+	line = strings.TrimSuffix(line, "\r")
+	w.hook(OutputLine{Node: utils.NodeName, Check: w.check, Stream: w.stream, Line: line, Time: time.Now()})
+}
@@ -1,8 +1,10 @@
 package utils
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"os"
 	"strconv"
 	"time"
@@ -12,11 +14,13 @@ import (
 	"github.com/thanhpk/randstr"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/klog/v2"
@@ -93,7 +97,8 @@ func GPUsAvailability() bool {
 	return true
 }
 
-func CreateJob(healthcheck string) error {
+// CreateJob creates the Job running the invasive health checks on the node, and returns its name
+func CreateJob(healthcheck string) (string, error) {
 	var args []string
 	var cmd []string
 	switch healthcheck {
@@ -106,14 +111,14 @@ func CreateJob(healthcheck string) error {
 	fieldselector, err := fields.ParseSelector("metadata.name=" + PodName)
 	if err != nil {
 		klog.Info("Error in creating the field selector", err.Error())
-		return err
+		return "", err
 	}
 	pods, err := cset.Cset.CoreV1().Pods("autopilot").List(context.TODO(), metav1.ListOptions{
 		FieldSelector: fieldselector.String(),
 	})
 	if err != nil {
 		klog.Info("Cannot get pod:", err.Error())
-		return err
+		return "", err
 	}
 	autopilotPod := pods.Items[0]
 	// setting TTL to 30 sec, but looking for used defined value
@@ -178,10 +183,29 @@ func CreateJob(healthcheck string) error {
 		metav1.CreateOptions{})
 	if err != nil {
 		klog.Info("Couldn't create Job ", err.Error())
-		return err
+		return "", err
 	}
 	klog.Info("Created")
-	return nil
+	return job.Name, nil
+}
+
+// DeleteJob deletes a Job and its pods, and waits until they are gone, i.e., until the pods released their GPUs,
+// or until ctx is done
+func DeleteJob(ctx context.Context, name string) error {
+	jobs := GetClientsetInstance().Cset.BatchV1().Jobs(Namespace)
+	propagation := metav1.DeletePropagationForeground
+	err := jobs.Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// With foreground deletion, the Job is removed once its pods are
+	return wait.PollUntilContextCancel(ctx, time.Second, true, func(ctx context.Context) (bool, error) {
+		_, err := jobs.Get(ctx, name, metav1.GetOptions{})
+		return apierrors.IsNotFound(err), nil
+	})
 }
 
 func PatchNode(label string, nodename string, force bool) error {
@@ -194,7 +218,7 @@ func PatchNode(label string, nodename string, force bool) error {
 		return err
 	}
 	labels := node.GetLabels()
-	if current, found := labels["autopilot.ibm.com/gpuhealth"]; found {
+	if current, found := labels[GPUHealthLabelKey]; found {
 		klog.Info("Node ", nodename, " label found ", current)
 		if current == "TESTING" || current == "EVICT" {
 			if !force {
@@ -216,6 +240,59 @@ func PatchNode(label string, nodename string, force bool) error {
 	return nil
 }
 
+// SetGPUHealthTesting sets the gpuhealth label of the node to TESTING, and remembers its previous value for RestoreGPUHealth
+func SetGPUHealthTesting(nodename string) error {
+	node, err := GetNode(nodename)
+	if err != nil {
+		return err
+	}
+	previous, found := node.GetLabels()[GPUHealthLabelKey]
+	if err := PatchNode(GPUHealthTestingLabel, nodename, true); err != nil {
+		return err
+	}
+	gpuHealthLock.Lock()
+	defer gpuHealthLock.Unlock()
+	if previous != "TESTING" {
+		gpuHealthBeforeTesting = &gpuHealthLabel{value: previous, found: found}
+	}
+	return nil
+}
+
+// RestoreGPUHealth sets the gpuhealth label of the node back to its value before SetGPUHealthTesting, e.g., when the daemon
+// stops while the invasive checks run. The label is left alone if it is no longer TESTING, or if this daemon did not set it.
+func RestoreGPUHealth(nodename string) error {
+	gpuHealthLock.Lock()
+	previous := gpuHealthBeforeTesting
+	gpuHealthBeforeTesting = nil
+	gpuHealthLock.Unlock()
+	if previous == nil {
+		return nil
+	}
+	node, err := GetNode(nodename)
+	if err != nil {
+		return err
+	}
+	if current := node.GetLabels()[GPUHealthLabelKey]; current != "TESTING" {
+		klog.Info("Node ", nodename, " label already updated to ", current, ", not restoring it")
+		return nil
+	}
+	// A null value removes the label
+	var value interface{}
+	if previous.found {
+		value = previous.value
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{GPUHealthLabelKey: value},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	klog.Info("Restoring the label of node ", nodename, " to its value before testing")
+	return PatchNode(string(patch), nodename, true)
+}
+
 // ParseInterval parses a duration string and returns the duration.
 // @param interval: duration string like "1h30m", "45m", or "2s"
 // @return: time.Duration or error if the format is invalid
@@ -227,3 +304,14 @@ func ParseInterval(interval string) (time.Duration, error) {
 
 	return d, nil
 }
+
+// Splay returns a delay in [0, max), derived from a hash of the node name and key.
+// It spreads the periodic work of the DaemonSet pods over time, while being stable across restarts of the same node.
+func Splay(nodename string, key string, max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write([]byte(nodename + "/" + key))
+	return time.Duration(h.Sum64() % uint64(max))
+}
@@ -29,3 +29,23 @@ func TestParseInterval(t *testing.T) {
 		}
 	}
 }
+
+// TestSplay tests that the node splay is deterministic and bounded
+func TestSplay(t *testing.T) {
+	max := 10 * time.Minute
+	for _, node := range []string{"node-1", "node-2", "gpu-node-a100-17"} {
+		splay := Splay(node, "periodic", max)
+		if splay < 0 || splay >= max {
+			t.Errorf("Expected splay in [0,%v) for %q, got %v", max, node, splay)
+		}
+		if again := Splay(node, "periodic", max); again != splay {
+			t.Errorf("Expected the same splay for %q, got %v and %v", node, splay, again)
+		}
+	}
+	if Splay("node-1", "periodic", max) == Splay("node-2", "periodic", max) {
+		t.Errorf("Expected different splays for different nodes")
+	}
+	if splay := Splay("node-1", "periodic", 0); splay != 0 {
+		t.Errorf("Expected no splay when disabled, got %v", splay)
+	}
+}
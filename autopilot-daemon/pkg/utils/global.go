@@ -20,7 +20,7 @@ type K8sClientset struct {
 var k8sClientset *K8sClientset
 var csetLock sync.Mutex
 
-var HealthcheckLock sync.Mutex
+var HealthcheckLock CheckLock
 
 var CPUModel string
 var GPUModel string
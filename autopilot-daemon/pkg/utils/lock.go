@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Returned by CheckLock.Wait when the queue is full
+var ErrQueueFull = errors.New("too many health check runs waiting")
+
+// LockHolder describes the checks holding the health check lock
+type LockHolder struct {
+	Checks string    `json:"checks"`
+	Since  time.Time `json:"since"`
+}
+
+// CheckLock serializes the health checks run on the node. Unlike a mutex, it tells which checks hold it and since when,
+// and it is handed over to the waiters in FIFO order.
+type CheckLock struct {
+	lock    sync.Mutex
+	holder  *LockHolder
+	waiters []*lockWaiter
+}
+
+type lockWaiter struct {
+	checks string
+	// Closed once the lock is handed over to the waiter
+	ready chan struct{}
+	// Signaled when the waiter moves up in the queue
+	moved chan struct{}
+}
+
+// TryLock takes the lock for checks if it is free, otherwise it returns its holder
+func (l *CheckLock) TryLock(checks string) (LockHolder, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.holder != nil {
+		return *l.holder, false
+	}
+	l.holder = &LockHolder{Checks: checks, Since: time.Now()}
+	return *l.holder, true
+}
+
+// Lock takes the lock for checks, waiting as long as needed
+func (l *CheckLock) Lock(checks string) {
+	l.Wait(context.Background(), checks, -1, nil)
+}
+
+// Wait takes the lock for checks, waiting in a queue of at most maxWaiters (unbounded if negative) until ctx is done.
+// While waiting, position is called with the position in the queue, starting at 1, whenever it changes.
+func (l *CheckLock) Wait(ctx context.Context, checks string, maxWaiters int, position func(int)) error {
+	l.lock.Lock()
+	if l.holder == nil {
+		l.holder = &LockHolder{Checks: checks, Since: time.Now()}
+		l.lock.Unlock()
+		return nil
+	}
+	if maxWaiters >= 0 && len(l.waiters) >= maxWaiters {
+		l.lock.Unlock()
+		return ErrQueueFull
+	}
+	w := &lockWaiter{checks: checks, ready: make(chan struct{}), moved: make(chan struct{}, 1)}
+	l.waiters = append(l.waiters, w)
+	l.lock.Unlock()
+
+	for {
+		if position != nil {
+			if p := l.position(w); p > 0 {
+				position(p)
+			}
+		}
+		select {
+		case <-w.ready:
+			return nil
+		case <-w.moved:
+		case <-ctx.Done():
+			l.lock.Lock()
+			select {
+			case <-w.ready:
+				// Handed over in the meantime, pass it on
+				l.lock.Unlock()
+				l.Unlock()
+				return ctx.Err()
+			default:
+			}
+			l.remove(w)
+			l.lock.Unlock()
+			return ctx.Err()
+		}
+	}
+}
+
+// Unlock releases the lock, handing it over to the first waiter, if any
+func (l *CheckLock) Unlock() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if len(l.waiters) == 0 {
+		l.holder = nil
+		return
+	}
+	w := l.waiters[0]
+	l.holder = &LockHolder{Checks: w.checks, Since: time.Now()}
+	l.remove(w)
+	close(w.ready)
+}
+
+// Holder returns the holder of the lock, if it is held
+func (l *CheckLock) Holder() (LockHolder, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.holder == nil {
+		return LockHolder{}, false
+	}
+	return *l.holder, true
+}
+
+// Waiting returns the number of waiters in the queue
+func (l *CheckLock) Waiting() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return len(l.waiters)
+}
+
+func (l *CheckLock) position(w *lockWaiter) int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for i, waiter := range l.waiters {
+		if waiter == w {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// remove drops a waiter from the queue, and tells the ones behind that they moved up. The caller must hold l.lock.
+func (l *CheckLock) remove(w *lockWaiter) {
+	for i, waiter := range l.waiters {
+		if waiter != w {
+			continue
+		}
+		l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+		for _, behind := range l.waiters[i:] {
+			select {
+			case behind.moved <- struct{}{}:
+			default:
+			}
+		}
+		return
+	}
+}
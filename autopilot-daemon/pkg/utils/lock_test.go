@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestCheckLock tests that the lock is handed over in FIFO order, that waiters see their position,
+// and that the queue is bounded
+func TestCheckLock(t *testing.T) {
+	var l CheckLock
+	if _, locked := l.TryLock("first"); !locked {
+		t.Fatal("Expected a free lock to be taken")
+	}
+	if holder, locked := l.TryLock("other"); locked || holder.Checks != "first" {
+		t.Fatalf("Expected the lock to be held by first, got %+v", holder)
+	}
+
+	order := make(chan string, 2)
+	positions := make(chan int, 4)
+	// Keeps second from handing the lock over to third before third sees it moved up
+	release := make(chan struct{})
+	wait := func(checks string, position func(int)) {
+		if err := l.Wait(context.Background(), checks, 2, position); err != nil {
+			t.Error(err)
+			return
+		}
+		order <- checks
+		if checks == "second" {
+			<-release
+		}
+		l.Unlock()
+	}
+	go wait("second", nil)
+	for l.Waiting() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	go wait("third", func(position int) { positions <- position })
+	for l.Waiting() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := l.Wait(context.Background(), "fourth", 2, nil); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected a full queue, got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.Wait(ctx, "fifth", -1, nil); !errors.Is(err, context.Canceled) || l.Waiting() != 2 {
+		t.Errorf("Expected a cancelled waiter to leave the queue, got %v with %d waiting", err, l.Waiting())
+	}
+
+	l.Unlock()
+	if p := <-positions; p != 2 {
+		t.Errorf("Expected third to start at position 2, got %d", p)
+	}
+	if p := <-positions; p != 1 {
+		t.Errorf("Expected third to move up to position 1, got %d", p)
+	}
+	close(release)
+	if first, second := <-order, <-order; first != "second" || second != "third" {
+		t.Errorf("Expected second then third, got %s then %s", first, second)
+	}
+	if _, held := l.Holder(); held {
+		t.Errorf("Expected the lock to be free")
+	}
+}
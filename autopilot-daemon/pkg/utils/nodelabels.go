@@ -1,5 +1,20 @@
 package utils
 
+import "sync"
+
+const GPUHealthLabelKey = "autopilot.ibm.com/gpuhealth"
+
+type gpuHealthLabel struct {
+	value string
+	found bool
+}
+
+// The gpuhealth label of the node before this daemon set it to TESTING, nil if it did not
+var (
+	gpuHealthLock          sync.Mutex
+	gpuHealthBeforeTesting *gpuHealthLabel
+)
+
 // All GPU tests pass
 var GPUHealthPassLabel string = `
 	{
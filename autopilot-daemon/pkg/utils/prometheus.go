@@ -25,11 +25,51 @@ var (
 		},
 		[]string{"health", "node", "cpumodel", "gpumodel", "deviceid"},
 	)
+
+	HchecksTimeouts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "autopilot",
+			Name:      "health_checks_timeouts_total",
+			Help:      "Number of health check runs killed because they exceeded their timeout",
+		},
+		[]string{"health", "node"},
+	)
+
+	HchecksStreak = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "autopilot",
+			Name:      "health_checks_streak",
+			Help:      "Number of consecutive failed (status=fail) or successful (status=pass) runs of each health check",
+		},
+		[]string{"health", "node", "status"},
+	)
+
+	HchecksProfile = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "autopilot",
+			Name:      "health_checks_profile",
+			Help:      "Threshold profile matching the node, always 1",
+		},
+		[]string{"node", "profile"},
+	)
+
+	HchecksThreshold = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "autopilot",
+			Name:      "health_checks_threshold",
+			Help:      "Bounds (bound=min or max) of the health checks measurements, from the threshold profile matching the node",
+		},
+		[]string{"health", "node", "profile", "bound"},
+	)
 )
 
 func InitMetrics(reg prometheus.Registerer) {
 	// Register custom metrics with the global prometheus registry
 	reg.MustRegister(HchecksGauge)
+	reg.MustRegister(HchecksTimeouts)
+	reg.MustRegister(HchecksStreak)
+	reg.MustRegister(HchecksProfile)
+	reg.MustRegister(HchecksThreshold)
 }
 
 func InitHardwareMetrics() {
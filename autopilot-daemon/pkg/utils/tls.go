@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// How often the TLS files are checked for changes, at most
+const tlsCheckInterval = 10 * time.Second
+
+// watchedFiles tells when a set of files changed, e.g., when the secret they are mounted from is updated
+type watchedFiles struct {
+	files   []string
+	modTime time.Time
+	checked time.Time
+}
+
+// changed tells whether any file was modified since the last call. The caller must serialize the calls.
+func (w *watchedFiles) changed() bool {
+	if time.Since(w.checked) < tlsCheckInterval {
+		return false
+	}
+	w.checked = time.Now()
+	latest := time.Time{}
+	for _, file := range w.files {
+		info, err := os.Stat(file)
+		if err != nil {
+			klog.Info("Cannot check ", file, ": ", err.Error())
+			return false
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	if latest.Equal(w.modTime) {
+		return false
+	}
+	w.modTime = latest
+	return true
+}
+
+// TLSFiles serves a certificate, its key and a CA bundle read from files, e.g., mounted from a secret.
+// The files are read again when they change, so that rotated certificates are used without a restart.
+// A file that cannot be read keeps the previous content in use. It is safe for concurrent use.
+type TLSFiles struct {
+	lock     sync.Mutex
+	certFile string
+	keyFile  string
+	caFile   string
+	watch    watchedFiles
+	cert     *tls.Certificate
+	ca       *x509.CertPool
+}
+
+// NewTLSFiles loads a certificate and its key, and a CA bundle verifying the peers if caFile is not empty
+func NewTLSFiles(certFile string, keyFile string, caFile string) (*TLSFiles, error) {
+	files := []string{certFile, keyFile}
+	if caFile != "" {
+		files = append(files, caFile)
+	}
+	t := &TLSFiles{certFile: certFile, keyFile: keyFile, caFile: caFile, watch: watchedFiles{files: files}}
+	t.watch.changed()
+	if err := t.load(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *TLSFiles) load() error {
+	cert, err := tls.LoadX509KeyPair(t.certFile, t.keyFile)
+	if err != nil {
+		return err
+	}
+	var ca *x509.CertPool
+	if t.caFile != "" {
+		pem, err := os.ReadFile(t.caFile)
+		if err != nil {
+			return err
+		}
+		ca = x509.NewCertPool()
+		if !ca.AppendCertsFromPEM(pem) {
+			return errors.New("no certificate found in " + t.caFile)
+		}
+	}
+	t.cert = &cert
+	t.ca = ca
+	return nil
+}
+
+// current returns the certificate and the CA bundle in use, after reloading them if their files changed
+func (t *TLSFiles) current() (*tls.Certificate, *x509.CertPool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.watch.changed() {
+		if err := t.load(); err != nil {
+			klog.Error("Cannot reload the TLS certificate, keeping the previous one: ", err.Error())
+		} else {
+			klog.Info("Reloaded the TLS certificate from ", t.certFile)
+		}
+	}
+	return t.cert, t.ca
+}
+
+// ServerConfig returns the TLS configuration of a listener. Client certificates are verified against the CA bundle
+// as requested by clientAuth, which must be tls.NoClientCert without a CA bundle.
+func (t *TLSFiles) ServerConfig(clientAuth tls.ClientAuthType) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, _ := t.current()
+			return cert, nil
+		},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, ca := t.current()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				ClientCAs:    ca,
+				ClientAuth:   clientAuth,
+			}, nil
+		},
+	}
+}
+
+// ClientConfig returns the TLS configuration of the calls to other Autopilot pods. The certificate is presented
+// to them for mutual TLS, and theirs must be signed by the CA bundle and valid for serverName, as pods are called by IP.
+func (t *TLSFiles) ClientConfig(serverName string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := t.current()
+			return cert, nil
+		},
+		// The peer is verified below, against the current CA bundle rather than one fixed in the configuration
+		InsecureSkipVerify: true,
+		VerifyConnection: func(state tls.ConnectionState) error {
+			_, ca := t.current()
+			if ca == nil {
+				return errors.New("no CA bundle to verify the peer")
+			}
+			if len(state.PeerCertificates) == 0 {
+				return errors.New("no peer certificate")
+			}
+			intermediates := x509.NewCertPool()
+			for _, cert := range state.PeerCertificates[1:] {
+				intermediates.AddCert(cert)
+			}
+			_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+				DNSName:       serverName,
+				Roots:         ca,
+				Intermediates: intermediates,
+			})
+			return err
+		},
+	}
+}
@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCert creates a certificate valid for name, signed by ca, or self-signed if ca is nil
+func newTestCert(t *testing.T, serial int64, name string, ca *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	parent, signer := template, key
+	if ca == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		parent, signer = ca.cert, ca.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key}
+}
+
+func (c *testCert) write(t *testing.T, certFile string, keyFile string) {
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if keyFile == "" {
+		return
+	}
+	der, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestTLSFiles tests mutual TLS between pods sharing a certificate, peer verification and certificate rotation
+func TestTLSFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+	ca := newTestCert(t, 1, "autopilot-ca", nil)
+	ca.write(t, caFile, "")
+	newTestCert(t, 2, "autopilot-healthchecks.autopilot.svc", ca).write(t, certFile, keyFile)
+	files, err := NewTLSFiles(certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			t.Errorf("Expected a client certificate")
+		}
+	}))
+	server.TLS = files.ServerConfig(tls.RequireAndVerifyClientCert)
+	server.StartTLS()
+	defer server.Close()
+
+	get := func(serverName string) (*http.Response, error) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: files.ClientConfig(serverName)}}
+		return client.Get(server.URL)
+	}
+	resp, err := get("autopilot-healthchecks.autopilot.svc")
+	if err != nil {
+		t.Fatalf("Expected the peer to be verified, got %v", err)
+	}
+	resp.Body.Close()
+	if serial := resp.TLS.PeerCertificates[0].SerialNumber.Int64(); serial != 2 {
+		t.Errorf("Expected certificate 2, got %d", serial)
+	}
+	if _, err := get("other.autopilot.svc"); err == nil {
+		t.Errorf("Expected a certificate for another name to be rejected")
+	}
+	if _, err := http.Get(server.URL); err == nil {
+		t.Errorf("Expected a client without certificate to be rejected")
+	}
+
+	// Rotation
+	newTestCert(t, 3, "autopilot-healthchecks.autopilot.svc", ca).write(t, certFile, keyFile)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	files.lock.Lock()
+	files.watch.checked = time.Time{}
+	files.lock.Unlock()
+	resp, err = get("autopilot-healthchecks.autopilot.svc")
+	if err != nil {
+		t.Fatalf("Expected the peer to be verified, got %v", err)
+	}
+	resp.Body.Close()
+	if serial := resp.TLS.PeerCertificates[0].SerialNumber.Int64(); serial != 3 {
+		t.Errorf("Expected the rotated certificate 3, got %d", serial)
+	}
+}
@@ -0,0 +1,43 @@
+##################################################################################
+# Autopilot result protocol, version 1. See HEALTH_CHECKS.md for the specification.
+# When the daemon sets AUTOPILOT_RESULT_PROTOCOL=1, health check scripts report
+# JSON records on stdout, one per line. Otherwise, they print free text as usual.
+##################################################################################
+import json
+import os
+
+VERSION = 1
+
+
+def enabled():
+    return os.getenv("AUTOPILOT_RESULT_PROTOCOL") == str(VERSION)
+
+
+def _emit(record):
+    record["v"] = VERSION
+    print(json.dumps(record), flush=True)
+
+
+def say(*args):
+    # Human readable output, wrapped in log records when the protocol is enabled
+    if not enabled():
+        print(*args)
+        return
+    for line in " ".join(str(a) for a in args).rstrip("\n").split("\n"):
+        _emit({"type": "log", "message": line})
+
+
+def observation(device, value, unit=None, threshold=None):
+    record = {"type": "observation", "device": str(device), "value": float(value)}
+    if unit is not None:
+        record["unit"] = unit
+    if threshold is not None:
+        record["threshold"] = float(threshold)
+    _emit(record)
+
+
+def status(status, message=None):
+    record = {"type": "status", "status": status}
+    if message:
+        record["message"] = message
+    _emit(record)
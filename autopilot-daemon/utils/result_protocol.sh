@@ -0,0 +1,37 @@
+#!/bin/bash
+# Autopilot result protocol, version 1. See HEALTH_CHECKS.md for the specification.
+# Source this file, then use the functions below. They only print when the daemon
+# sets AUTOPILOT_RESULT_PROTOCOL=1, so that scripts can keep their free text output otherwise.
+
+protocol_enabled() {
+  [[ "$AUTOPILOT_RESULT_PROTOCOL" == "1" ]]
+}
+
+_protocol_escape() {
+  local s=${1//\\/\\\\}
+  s=${s//\"/\\\"}
+  s=${s//$'\t'/ }
+  echo -n "$s"
+}
+
+# protocol_log <message>
+protocol_log() {
+  protocol_enabled || return 0
+  echo "{\"v\":1,\"type\":\"log\",\"message\":\"$(_protocol_escape "$1")\"}"
+}
+
+# protocol_observation <device> <value> [unit]
+protocol_observation() {
+  protocol_enabled || return 0
+  if [[ -n "$3" ]]; then
+    echo "{\"v\":1,\"type\":\"observation\",\"device\":\"$(_protocol_escape "$1")\",\"value\":$2,\"unit\":\"$(_protocol_escape "$3")\"}"
+  else
+    echo "{\"v\":1,\"type\":\"observation\",\"device\":\"$(_protocol_escape "$1")\",\"value\":$2}"
+  fi
+}
+
+# protocol_status <PASS|WARN|FAIL|ABORT|ERROR> [message]
+protocol_status() {
+  protocol_enabled || return 0
+  echo "{\"v\":1,\"type\":\"status\",\"status\":\"$1\",\"message\":\"$(_protocol_escape "$2")\"}"
+}